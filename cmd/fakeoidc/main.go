@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/0xSumeet/go_api/internal/oidc/oidctest"
+)
+
+// fakeoidc runs a local OpenID Connect provider approving every login, to try
+// the social login without a real provider
+func main() {
+	addr := flag.String("addr", "localhost:9000", "address to listen on")
+	issuer := flag.String("issuer", "http://localhost:9000", "issuer URL, where the provider is reachable")
+	clientID := flag.String("client-id", "go-api", "client id of the API")
+	clientSecret := flag.String("client-secret", "secret", "client secret of the API")
+	subject := flag.String("subject", "fake-user", "subject of the logged in user")
+	email := flag.String("email", "user@example.com", "email of the logged in user, login_hint overrides it")
+	name := flag.String("name", "Fake User", "name of the logged in user")
+	emailVerified := flag.Bool("email-verified", true, "whether the email is verified")
+	flag.Parse()
+
+	provider, err := oidctest.New(*clientID, *clientSecret)
+	if err != nil {
+		log.Fatalf("Error creating the provider: %s", err)
+	}
+	provider.Issuer = *issuer
+	provider.SetUser(oidctest.User{Subject: *subject, Email: *email, EmailVerified: *emailVerified, Name: *name})
+
+	log.Printf("Fake OIDC provider %s listening on %s", *issuer, *addr)
+	log.Fatal(http.ListenAndServe(*addr, provider))
+}
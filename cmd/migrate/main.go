@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/0xSumeet/go_api/internal/configs"
+	"github.com/0xSumeet/go_api/internal/database"
+	"github.com/0xSumeet/go_api/internal/migrations"
+
+	_ "github.com/lib/pq"
+)
+
+const usage = `usage: migrate [config flags] <command>
+
+commands:
+  up                 apply every pending migration
+  down [N]           revert the last N migrations (default 1)
+  status             list migrations and when they were applied
+  create NAME [DIR]  write a new up/down pair in DIR (default internal/migrations/sql)`
+
+func main() {
+	// Config flags come first, the command and its arguments after them
+	cfg, args, err := config.LoadCommand(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Error loading configuration: %s", err)
+	}
+	if len(args) == 0 {
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+
+	// create only writes files, it does not need the database
+	if args[0] == "create" {
+		if len(args) < 2 {
+			fmt.Println(usage)
+			os.Exit(2)
+		}
+		dir := "internal/migrations/sql"
+		if len(args) > 2 {
+			dir = args[2]
+		}
+		paths, err := migrations.Create(dir, args[1])
+		if err != nil {
+			log.Fatalf("Error creating migration: %s", err)
+		}
+		for _, path := range paths {
+			fmt.Println("created", path)
+		}
+		return
+	}
+
+	db, err := database.Open(cfg.Database)
+	if err != nil {
+		log.Fatalf("Error connecting to the database: %s", err)
+	}
+	defer db.Close()
+
+	runner, err := migrations.New(db)
+	if err != nil {
+		log.Fatalf("Error loading migrations: %s", err)
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := runner.Up(ctx)
+		for _, migration := range applied {
+			fmt.Printf("applied %06d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatalf("Error applying migrations: %s", err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("no pending migrations")
+		}
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				log.Fatalf("Invalid number of steps: %s", args[1])
+			}
+		}
+		reverted, err := runner.Down(ctx, steps)
+		for _, migration := range reverted {
+			fmt.Printf("reverted %06d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatalf("Error reverting migrations: %s", err)
+		}
+
+	case "status":
+		statuses, err := runner.Status(ctx)
+		if err != nil {
+			log.Fatalf("Error reading migration status: %s", err)
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = status.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Printf("%06d_%-40s %s\n", status.Version, status.Name, applied)
+		}
+
+	default:
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+}
@@ -1,19 +1,123 @@
 package main
 
 import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/0xSumeet/go_api/internal/configs"
 	"github.com/0xSumeet/go_api/internal/database"
+	"github.com/0xSumeet/go_api/internal/handlers"
+	"github.com/0xSumeet/go_api/internal/health"
+	"github.com/0xSumeet/go_api/internal/mailer"
+	"github.com/0xSumeet/go_api/internal/migrations"
+	"github.com/0xSumeet/go_api/internal/passwordpolicy"
+	"github.com/0xSumeet/go_api/internal/purge"
 	"github.com/0xSumeet/go_api/internal/routes"
+	"github.com/0xSumeet/go_api/internal/server"
+	"github.com/0xSumeet/go_api/pkg/utils"
 	"github.com/gin-gonic/gin"
 
 	_ "github.com/lib/pq"
 )
 
 func main() {
-	database.Init()
-	// Close the db connection, after main function is executed
-	defer database.DB.Close()
+	// Load the configuration from the config file, environment and flags
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Error loading configuration: %s", err)
+	}
+
+	if !cfg.IsDev() {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	// Asymmetric signing keys replace the jwt secret when configured
+	var keys *utils.KeySet
+	if len(cfg.Auth.SigningKeys) > 0 {
+		keys, err = utils.LoadKeySet(cfg.Auth.SigningKeys, cfg.Auth.AccessTokenTTL.Duration)
+		if err != nil {
+			log.Fatalf("Error loading jwt keys: %s", err)
+		}
+	}
+
+	// The breached password list is held in memory
+	var breached *passwordpolicy.BreachedList
+	if file := cfg.Auth.PasswordPolicy.BreachedPasswordsFile; file != "" {
+		breached, err = passwordpolicy.LoadBreached(file)
+		if err != nil {
+			log.Fatalf("Error loading breached passwords: %s", err)
+		}
+		log.Printf("Loaded %d breached password hashes", breached.Len())
+	}
+
+	mail, err := mailer.New(cfg.Mail)
+	if err != nil {
+		log.Fatalf("Error configuring the mailer: %s", err)
+	}
+
+	db, err := database.Open(cfg.Database)
+	if err != nil {
+		log.Fatalf("Error connecting to the database: %s", err)
+	}
 
 	app := gin.Default()
-	routes.SetupRoutes(app)
-	app.Run(":4000")
+	// Only the configured proxies can set the client IP used by the login lockout
+	if err := app.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatalf("Error setting the trusted proxies: %s", err)
+	}
+	srv := server.New(cfg.ListenAddr, cfg.Server, app)
+
+	runner, err := migrations.New(db)
+	if err != nil {
+		log.Fatalf("Error loading migrations: %s", err)
+	}
+
+	// Dependencies checked by /readyz
+	checks := health.NewRegistry(cfg.Server.HealthCheckTimeout.Duration)
+	checks.Register("database", health.Database(db))
+	checks.Register("migrations", health.Migrations(runner))
+
+	store := database.NewPostgresStore(db)
+	h := handlers.New(cfg, store)
+	if keys != nil {
+		h.Keys = keys
+	}
+	h.Mailer = mail
+	h.PasswordPolicy = passwordpolicy.New(cfg.Auth.PasswordPolicy, breached)
+	h.Ready = srv.Ready
+	h.Health = checks
+	routes.SetupRoutes(app, h)
+
+	// Deleted products are purged in the background once they are old enough
+	ctx, cancel := context.WithCancel(context.Background())
+	purged := make(chan struct{})
+	if days := cfg.Products.PurgeAfterDays; days > 0 {
+		go func() {
+			purge.Run(ctx, store.Products, time.Duration(days)*24*time.Hour, cfg.Products.PurgeInterval.Duration)
+			close(purged)
+		}()
+	} else {
+		close(purged)
+	}
+
+	// Run blocks until the server is drained, the db pool is closed afterwards
+	// so in-flight requests, the purge and the background work can still use it
+	runErr := srv.Run(ctx)
+	cancel()
+	<-purged
+
+	// The emails of the last requests are sent in the background
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout.Duration)
+	if err := h.Wait(drainCtx); err != nil {
+		log.Printf("Error waiting for the background work: %s", err)
+	}
+	cancelDrain()
+	if err := db.Close(); err != nil {
+		log.Printf("Error closing the database: %s", err)
+	}
+	if runErr != nil {
+		log.Fatalf("Server error: %s", runErr)
+	}
 }
@@ -0,0 +1,42 @@
+package config
+
+import "testing"
+
+func TestValidateSecrets(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(*Config)
+		valid     bool
+	}{
+		{"dev defaults", func(*Config) {}, true},
+		{"prod defaults", func(c *Config) { c.Env = EnvProd }, false},
+		{"prod secrets", func(c *Config) {
+			c.Env = EnvProd
+			c.JWTSecret = "jwt"
+			c.Pagination.CursorSecret = "cursor"
+		}, true},
+		{"prod default cursor secret", func(c *Config) {
+			c.Env = EnvProd
+			c.JWTSecret = "jwt"
+		}, false},
+		{"prod signing keys and default cursor secret", func(c *Config) {
+			c.Env = EnvProd
+			c.Auth.SigningKeys = []SigningKey{{ID: "1", PublicKeyFile: "key.pem"}}
+		}, false},
+		{"prod signing keys", func(c *Config) {
+			c.Env = EnvProd
+			c.Auth.SigningKeys = []SigningKey{{ID: "1", PublicKeyFile: "key.pem"}}
+			c.Pagination.CursorSecret = "cursor"
+		}, true},
+		{"empty cursor secret", func(c *Config) { c.Pagination.CursorSecret = "" }, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := Default()
+			test.configure(cfg)
+			if err := cfg.Validate(); (err == nil) != test.valid {
+				t.Errorf("got %v, want valid %v", err, test.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package cursor
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type position struct {
+	ID   int    `json:"id"`
+	Sort string `json:"sort"`
+}
+
+func TestEncodeDecode(t *testing.T) {
+	signer := NewSigner("secret")
+	cursor, err := signer.Encode(position{ID: 42, Sort: "-price"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.ContainsAny(cursor, "+/=") {
+		t.Errorf("%q is not URL safe", cursor)
+	}
+
+	var got position
+	if err := signer.Decode(cursor, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got != (position{ID: 42, Sort: "-price"}) {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	signer := NewSigner("secret")
+	cursor, err := signer.Encode(position{ID: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewSigner("other secret").Encode(position{ID: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, signature, _ := strings.Cut(cursor, ".")
+	forged, _, _ := strings.Cut(mustEncode(t, signer, position{ID: 43}), ".")
+
+	for name, value := range map[string]string{
+		"empty":          "",
+		"no signature":   payload,
+		"other secret":   other,
+		"other payload":  forged + "." + signature,
+		"bad signature":  payload + ".AAAA",
+		"not base64":     "!!!." + signature,
+		"truncated":      cursor[:len(cursor)-1],
+		"extra dot":      cursor + ".",
+		"not json":       "bm90IGpzb24." + signature,
+		"swapped halves": signature + "." + payload,
+	} {
+		t.Run(name, func(t *testing.T) {
+			var got position
+			if err := signer.Decode(value, &got); !errors.Is(err, ErrInvalid) {
+				t.Errorf("got %v, want ErrInvalid", err)
+			}
+		})
+	}
+}
+
+func mustEncode(t *testing.T, signer *Signer, value any) string {
+	t.Helper()
+	cursor, err := signer.Encode(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cursor
+}
+
+func TestSignersDiffer(t *testing.T) {
+	cursor := mustEncode(t, NewSigner("secret"), position{ID: 1})
+	var got position
+	if err := NewSigner("other").Decode(cursor, &got); !errors.Is(err, ErrInvalid) {
+		t.Errorf("got %v, want a cursor of another secret refused", err)
+	}
+}
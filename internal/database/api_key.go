@@ -0,0 +1,143 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// APIKey is a long-lived credential limited to its scopes, UserID is nil for
+// the service keys
+type APIKey struct {
+	ID         int64      `json:"id"`
+	UserID     *int       `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	KeyHash    string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Active reports whether the key is neither revoked nor expired at now
+func (k *APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// apiKeyTouchInterval limits the writes of last_used_at for busy keys
+const apiKeyTouchInterval = time.Minute
+
+type APIKeyRepository interface {
+	CreateAPIKey(ctx context.Context, key *APIKey) error
+	GetAPIKey(ctx context.Context, id int64) (*APIKey, error)
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (*APIKey, error)
+	// ListAPIKeys returns the keys of a user, or the service keys when userID is nil
+	ListAPIKeys(ctx context.Context, userID *int) ([]APIKey, error)
+	RevokeAPIKey(ctx context.Context, id int64) error
+	// TouchAPIKey updates last_used_at, at most once per minute
+	TouchAPIKey(ctx context.Context, id int64) error
+}
+
+type PostgresAPIKeyRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresAPIKeyRepository(db *sql.DB) *PostgresAPIKeyRepository {
+	return &PostgresAPIKeyRepository{db: db}
+}
+
+const apiKeyColumns = "id, user_id, name, prefix, key_hash, scopes, expires_at, last_used_at, created_at, revoked_at"
+
+func scanAPIKey(row interface{ Scan(...any) error }) (*APIKey, error) {
+	var key APIKey
+	err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.KeyHash, pq.Array(&key.Scopes),
+		&key.ExpiresAt, &key.LastUsedAt, &key.CreatedAt, &key.RevokedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *PostgresAPIKeyRepository) CreateAPIKey(ctx context.Context, key *APIKey) error {
+	query := `INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        RETURNING id, created_at`
+	err := r.db.QueryRowContext(ctx, query, key.UserID, key.Name, key.Prefix, key.KeyHash, pq.Array(key.Scopes), key.ExpiresAt).
+		Scan(&key.ID, &key.CreatedAt)
+	if isForeignKeyViolation(err) {
+		return ErrNotFound
+	} else if err != nil {
+		return fmt.Errorf("could not create api key: %v", err)
+	}
+	return nil
+}
+
+func (r *PostgresAPIKeyRepository) GetAPIKey(ctx context.Context, id int64) (*APIKey, error) {
+	return r.getAPIKey(ctx, "id = $1", id)
+}
+
+func (r *PostgresAPIKeyRepository) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*APIKey, error) {
+	return r.getAPIKey(ctx, "prefix = $1", prefix)
+}
+
+func (r *PostgresAPIKeyRepository) getAPIKey(ctx context.Context, where string, arg any) (*APIKey, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE "+where, arg)
+	key, err := scanAPIKey(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (r *PostgresAPIKeyRepository) ListAPIKeys(ctx context.Context, userID *int) ([]APIKey, error) {
+	query := "SELECT " + apiKeyColumns + " FROM api_keys WHERE user_id = $1 ORDER BY id"
+	args := []any{userID}
+	if userID == nil {
+		query = "SELECT " + apiKeyColumns + " FROM api_keys WHERE user_id IS NULL ORDER BY id"
+		args = nil
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+func (r *PostgresAPIKeyRepository) RevokeAPIKey(ctx context.Context, id int64) error {
+	query := "UPDATE api_keys SET revoked_at = COALESCE(revoked_at, NOW()) WHERE id = $1"
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("could not revoke api key: %v", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *PostgresAPIKeyRepository) TouchAPIKey(ctx context.Context, id int64) error {
+	query := `UPDATE api_keys SET last_used_at = NOW()
+        WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < $2)`
+	_, err := r.db.ExecContext(ctx, query, id, time.Now().Add(-apiKeyTouchInterval))
+	return err
+}
@@ -0,0 +1,107 @@
+package database
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type MemoryAPIKeyRepository struct {
+	mu     sync.Mutex
+	users  UserRepository
+	nextID int64
+	keys   map[int64]APIKey
+}
+
+func NewMemoryAPIKeyRepository(users UserRepository) *MemoryAPIKeyRepository {
+	return &MemoryAPIKeyRepository{users: users, nextID: 1, keys: map[int64]APIKey{}}
+}
+
+func (r *MemoryAPIKeyRepository) CreateAPIKey(ctx context.Context, key *APIKey) error {
+	if key.UserID != nil {
+		if _, err := r.users.GetUserByID(ctx, *key.UserID); err != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key.ID = r.nextID
+	key.CreatedAt = time.Now()
+	r.keys[key.ID] = *key
+	r.nextID++
+	return nil
+}
+
+func (r *MemoryAPIKeyRepository) GetAPIKey(ctx context.Context, id int64) (*APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.keys[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &key, nil
+}
+
+func (r *MemoryAPIKeyRepository) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, key := range r.keys {
+		if key.Prefix == prefix {
+			return &key, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryAPIKeyRepository) ListAPIKeys(ctx context.Context, userID *int) ([]APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys := []APIKey{}
+	for id := int64(1); id < r.nextID; id++ {
+		key, ok := r.keys[id]
+		if !ok {
+			continue
+		}
+		if (userID == nil && key.UserID == nil) || (userID != nil && key.UserID != nil && *key.UserID == *userID) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (r *MemoryAPIKeyRepository) RevokeAPIKey(ctx context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.keys[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if key.RevokedAt == nil {
+		now := time.Now()
+		key.RevokedAt = &now
+		r.keys[id] = key
+	}
+	return nil
+}
+
+func (r *MemoryAPIKeyRepository) TouchAPIKey(ctx context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.keys[id]
+	if !ok {
+		return nil
+	}
+	now := time.Now()
+	if key.LastUsedAt == nil || key.LastUsedAt.Before(now.Add(-apiKeyTouchInterval)) {
+		key.LastUsedAt = &now
+		r.keys[id] = key
+	}
+	return nil
+}
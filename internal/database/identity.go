@@ -0,0 +1,157 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrIdentityExists = errors.New("this identity is already linked")
+
+// Identity links the account of an OpenID Connect provider, by its subject, to a user
+type Identity struct {
+	ID          int64      `json:"id"`
+	UserID      int        `json:"-"`
+	Provider    string     `json:"provider"`
+	Subject     string     `json:"subject"`
+	Email       string     `json:"email"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+}
+
+// OIDCLoginState holds the nonce and PKCE verifier of a pending provider login
+type OIDCLoginState struct {
+	StateHash    string
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+	CreatedAt    time.Time
+}
+
+type IdentityRepository interface {
+	// CreateIdentity returns ErrIdentityExists when the subject is already linked
+	CreateIdentity(ctx context.Context, identity *Identity) error
+	GetIdentity(ctx context.Context, provider, subject string) (*Identity, error)
+	ListUserIdentities(ctx context.Context, userID int) ([]Identity, error)
+	// DeleteIdentity unlinks an identity of the user
+	DeleteIdentity(ctx context.Context, userID int, id int64) error
+	// TouchIdentity records a login with the identity
+	TouchIdentity(ctx context.Context, id int64) error
+
+	CreateOIDCLoginState(ctx context.Context, state *OIDCLoginState) error
+	// ConsumeOIDCLoginState deletes and returns the state if it has not expired
+	ConsumeOIDCLoginState(ctx context.Context, provider, stateHash string) (*OIDCLoginState, error)
+}
+
+type PostgresIdentityRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresIdentityRepository(db *sql.DB) *PostgresIdentityRepository {
+	return &PostgresIdentityRepository{db: db}
+}
+
+func (r *PostgresIdentityRepository) CreateIdentity(ctx context.Context, identity *Identity) error {
+	query := `INSERT INTO identities (user_id, provider, subject, email, last_login_at)
+        VALUES ($1, $2, $3, $4, $5)
+        RETURNING id, created_at`
+	err := r.db.QueryRowContext(ctx, query, identity.UserID, identity.Provider, identity.Subject, identity.Email, identity.LastLoginAt).
+		Scan(&identity.ID, &identity.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrIdentityExists
+	} else if isForeignKeyViolation(err) {
+		return ErrNotFound
+	} else if err != nil {
+		return fmt.Errorf("could not create identity: %v", err)
+	}
+	return nil
+}
+
+func (r *PostgresIdentityRepository) GetIdentity(ctx context.Context, provider, subject string) (*Identity, error) {
+	var identity Identity
+	query := `SELECT id, user_id, provider, subject, email, created_at, last_login_at
+        FROM identities WHERE provider = $1 AND subject = $2`
+	err := r.db.QueryRowContext(ctx, query, provider, subject).Scan(&identity.ID, &identity.UserID, &identity.Provider,
+		&identity.Subject, &identity.Email, &identity.CreatedAt, &identity.LastLoginAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (r *PostgresIdentityRepository) ListUserIdentities(ctx context.Context, userID int) ([]Identity, error) {
+	query := `SELECT id, user_id, provider, subject, email, created_at, last_login_at
+        FROM identities WHERE user_id = $1 ORDER BY id`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []Identity{}
+	for rows.Next() {
+		var identity Identity
+		err := rows.Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email,
+			&identity.CreatedAt, &identity.LastLoginAt)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+	return identities, rows.Err()
+}
+
+func (r *PostgresIdentityRepository) DeleteIdentity(ctx context.Context, userID int, id int64) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM identities WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return fmt.Errorf("could not delete identity: %v", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *PostgresIdentityRepository) TouchIdentity(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE identities SET last_login_at = NOW() WHERE id = $1", id)
+	return err
+}
+
+func (r *PostgresIdentityRepository) CreateOIDCLoginState(ctx context.Context, state *OIDCLoginState) error {
+	// Abandoned logins are removed with the next one
+	if _, err := r.db.ExecContext(ctx, "DELETE FROM oidc_login_states WHERE expires_at < NOW()"); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO oidc_login_states (state_hash, provider, nonce, code_verifier, expires_at)
+        VALUES ($1, $2, $3, $4, $5)
+        RETURNING created_at`
+	err := r.db.QueryRowContext(ctx, query, state.StateHash, state.Provider, state.Nonce, state.CodeVerifier, state.ExpiresAt).
+		Scan(&state.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("could not create login state: %v", err)
+	}
+	return nil
+}
+
+func (r *PostgresIdentityRepository) ConsumeOIDCLoginState(ctx context.Context, provider, stateHash string) (*OIDCLoginState, error) {
+	var state OIDCLoginState
+	query := `DELETE FROM oidc_login_states
+        WHERE state_hash = $1 AND provider = $2 AND expires_at > NOW()
+        RETURNING state_hash, provider, nonce, code_verifier, expires_at, created_at`
+	err := r.db.QueryRowContext(ctx, query, stateHash, provider).Scan(&state.StateHash, &state.Provider, &state.Nonce,
+		&state.CodeVerifier, &state.ExpiresAt, &state.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
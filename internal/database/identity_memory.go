@@ -0,0 +1,140 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+type MemoryIdentityRepository struct {
+	mu         sync.Mutex
+	users      UserRepository
+	nextID     int64
+	identities map[int64]Identity
+	states     map[string]OIDCLoginState
+}
+
+func NewMemoryIdentityRepository(users UserRepository) *MemoryIdentityRepository {
+	return &MemoryIdentityRepository{
+		users:      users,
+		nextID:     1,
+		identities: map[int64]Identity{},
+		states:     map[string]OIDCLoginState{},
+	}
+}
+
+func (r *MemoryIdentityRepository) CreateIdentity(ctx context.Context, identity *Identity) error {
+	if _, err := r.users.GetUserByID(ctx, identity.UserID); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.identities {
+		if existing.Provider == identity.Provider && existing.Subject == identity.Subject {
+			// Like the cascade, the identity of a deleted user is gone
+			if _, err := r.users.GetUserByID(ctx, existing.UserID); errors.Is(err, ErrNotFound) {
+				delete(r.identities, existing.ID)
+				break
+			}
+			return ErrIdentityExists
+		}
+	}
+	identity.ID = r.nextID
+	identity.CreatedAt = time.Now()
+	r.identities[identity.ID] = *identity
+	r.nextID++
+	return nil
+}
+
+func (r *MemoryIdentityRepository) GetIdentity(ctx context.Context, provider, subject string) (*Identity, error) {
+	r.mu.Lock()
+	var found *Identity
+	for _, identity := range r.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			found = &identity
+			break
+		}
+	}
+	r.mu.Unlock()
+	if found == nil {
+		return nil, ErrNotFound
+	}
+
+	// The identities of deleted users are gone with them, like the cascade
+	if _, err := r.users.GetUserByID(ctx, found.UserID); errors.Is(err, ErrNotFound) {
+		r.mu.Lock()
+		delete(r.identities, found.ID)
+		r.mu.Unlock()
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+func (r *MemoryIdentityRepository) ListUserIdentities(ctx context.Context, userID int) ([]Identity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	identities := []Identity{}
+	for id := int64(1); id < r.nextID; id++ {
+		if identity, ok := r.identities[id]; ok && identity.UserID == userID {
+			identities = append(identities, identity)
+		}
+	}
+	return identities, nil
+}
+
+func (r *MemoryIdentityRepository) DeleteIdentity(ctx context.Context, userID int, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	identity, ok := r.identities[id]
+	if !ok || identity.UserID != userID {
+		return ErrNotFound
+	}
+	delete(r.identities, id)
+	return nil
+}
+
+func (r *MemoryIdentityRepository) TouchIdentity(ctx context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if identity, ok := r.identities[id]; ok {
+		now := time.Now()
+		identity.LastLoginAt = &now
+		r.identities[id] = identity
+	}
+	return nil
+}
+
+func (r *MemoryIdentityRepository) CreateOIDCLoginState(ctx context.Context, state *OIDCLoginState) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for hash, existing := range r.states {
+		if existing.ExpiresAt.Before(now) {
+			delete(r.states, hash)
+		}
+	}
+	state.CreatedAt = now
+	r.states[state.StateHash] = *state
+	return nil
+}
+
+func (r *MemoryIdentityRepository) ConsumeOIDCLoginState(ctx context.Context, provider, stateHash string) (*OIDCLoginState, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	state, ok := r.states[stateHash]
+	if !ok || state.Provider != provider || !time.Now().Before(state.ExpiresAt) {
+		return nil, ErrNotFound
+	}
+	delete(r.states, stateHash)
+	return &state, nil
+}
@@ -0,0 +1,106 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// LoginAttempt records one login, UserID is nil when the email is unknown
+type LoginAttempt struct {
+	ID        int64     `json:"id"`
+	UserID    *int      `json:"user_id"`
+	Email     string    `json:"email"`
+	IP        string    `json:"ip"`
+	Succeeded bool      `json:"succeeded"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LoginFailures counts the failed attempts of an account or IP, Last is the
+// time of the latest one
+type LoginFailures struct {
+	Count int
+	Last  time.Time
+}
+
+type LoginAttemptRepository interface {
+	RecordLoginAttempt(ctx context.Context, attempt *LoginAttempt) error
+	// AccountFailures counts the failures of email since since, cleared ones excepted
+	AccountFailures(ctx context.Context, email string, since time.Time) (LoginFailures, error)
+	// IPFailures counts the failures from ip since since, on any account
+	IPFailures(ctx context.Context, ip string, since time.Time) (LoginFailures, error)
+	// ClearAccountFailures stops counting the failures of email and of the user
+	ClearAccountFailures(ctx context.Context, email string, userID int) error
+	// ListLoginAttempts returns the latest attempts on the account of a user
+	ListLoginAttempts(ctx context.Context, userID int, limit int) ([]LoginAttempt, error)
+}
+
+type PostgresLoginAttemptRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresLoginAttemptRepository(db *sql.DB) *PostgresLoginAttemptRepository {
+	return &PostgresLoginAttemptRepository{db: db}
+}
+
+func (r *PostgresLoginAttemptRepository) RecordLoginAttempt(ctx context.Context, attempt *LoginAttempt) error {
+	query := `INSERT INTO login_attempts (user_id, email, ip, succeeded)
+        VALUES ($1, $2, $3, $4)
+        RETURNING id, created_at`
+	err := r.db.QueryRowContext(ctx, query, attempt.UserID, attempt.Email, attempt.IP, attempt.Succeeded).
+		Scan(&attempt.ID, &attempt.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("could not record login attempt: %v", err)
+	}
+	return nil
+}
+
+func (r *PostgresLoginAttemptRepository) AccountFailures(ctx context.Context, email string, since time.Time) (LoginFailures, error) {
+	query := `SELECT COUNT(*), MAX(created_at) FROM login_attempts
+        WHERE email = $1 AND NOT succeeded AND NOT cleared AND created_at > $2`
+	return r.failures(ctx, query, email, since)
+}
+
+func (r *PostgresLoginAttemptRepository) IPFailures(ctx context.Context, ip string, since time.Time) (LoginFailures, error) {
+	query := `SELECT COUNT(*), MAX(created_at) FROM login_attempts
+        WHERE ip = $1 AND NOT succeeded AND created_at > $2`
+	return r.failures(ctx, query, ip, since)
+}
+
+func (r *PostgresLoginAttemptRepository) failures(ctx context.Context, query string, key string, since time.Time) (LoginFailures, error) {
+	var failures LoginFailures
+	var last sql.NullTime
+	if err := r.db.QueryRowContext(ctx, query, key, since).Scan(&failures.Count, &last); err != nil {
+		return LoginFailures{}, err
+	}
+	failures.Last = last.Time
+	return failures, nil
+}
+
+func (r *PostgresLoginAttemptRepository) ClearAccountFailures(ctx context.Context, email string, userID int) error {
+	query := `UPDATE login_attempts SET cleared = TRUE
+        WHERE (email = $1 OR user_id = $2) AND NOT succeeded AND NOT cleared`
+	_, err := r.db.ExecContext(ctx, query, email, userID)
+	return err
+}
+
+func (r *PostgresLoginAttemptRepository) ListLoginAttempts(ctx context.Context, userID int, limit int) ([]LoginAttempt, error) {
+	query := `SELECT id, user_id, email, ip, succeeded, created_at FROM login_attempts
+        WHERE user_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2`
+	rows, err := r.db.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attempts := []LoginAttempt{}
+	for rows.Next() {
+		var attempt LoginAttempt
+		if err := rows.Scan(&attempt.ID, &attempt.UserID, &attempt.Email, &attempt.IP, &attempt.Succeeded, &attempt.CreatedAt); err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, attempt)
+	}
+	return attempts, rows.Err()
+}
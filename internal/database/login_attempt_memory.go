@@ -0,0 +1,88 @@
+package database
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type MemoryLoginAttemptRepository struct {
+	mu       sync.Mutex
+	nextID   int64
+	attempts []memoryLoginAttempt
+}
+
+type memoryLoginAttempt struct {
+	LoginAttempt
+	cleared bool
+}
+
+func NewMemoryLoginAttemptRepository() *MemoryLoginAttemptRepository {
+	return &MemoryLoginAttemptRepository{nextID: 1}
+}
+
+func (r *MemoryLoginAttemptRepository) RecordLoginAttempt(ctx context.Context, attempt *LoginAttempt) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attempt.ID = r.nextID
+	attempt.CreatedAt = time.Now()
+	r.attempts = append(r.attempts, memoryLoginAttempt{LoginAttempt: *attempt})
+	r.nextID++
+	return nil
+}
+
+func (r *MemoryLoginAttemptRepository) AccountFailures(ctx context.Context, email string, since time.Time) (LoginFailures, error) {
+	return r.failures(func(a memoryLoginAttempt) bool {
+		return a.Email == email && !a.cleared
+	}, since), nil
+}
+
+func (r *MemoryLoginAttemptRepository) IPFailures(ctx context.Context, ip string, since time.Time) (LoginFailures, error) {
+	return r.failures(func(a memoryLoginAttempt) bool {
+		return a.IP == ip
+	}, since), nil
+}
+
+func (r *MemoryLoginAttemptRepository) failures(match func(memoryLoginAttempt) bool, since time.Time) LoginFailures {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var failures LoginFailures
+	for _, attempt := range r.attempts {
+		if attempt.Succeeded || !attempt.CreatedAt.After(since) || !match(attempt) {
+			continue
+		}
+		failures.Count++
+		if attempt.CreatedAt.After(failures.Last) {
+			failures.Last = attempt.CreatedAt
+		}
+	}
+	return failures
+}
+
+func (r *MemoryLoginAttemptRepository) ClearAccountFailures(ctx context.Context, email string, userID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, attempt := range r.attempts {
+		if attempt.Email == email || (attempt.UserID != nil && *attempt.UserID == userID) {
+			r.attempts[i].cleared = true
+		}
+	}
+	return nil
+}
+
+func (r *MemoryLoginAttemptRepository) ListLoginAttempts(ctx context.Context, userID int, limit int) ([]LoginAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attempts := []LoginAttempt{}
+	for i := len(r.attempts) - 1; i >= 0 && len(attempts) < limit; i-- {
+		attempt := r.attempts[i]
+		if attempt.UserID != nil && *attempt.UserID == userID {
+			attempts = append(attempts, attempt.LoginAttempt)
+		}
+	}
+	return attempts, nil
+}
@@ -1,13 +1,21 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	_ "github.com/lib/pq"
 )
 
+// ErrVersionMismatch is returned when a product changed since the version a
+// write expects
+var ErrVersionMismatch = errors.New("the product was modified")
+
 type Product struct {
 	ID            int       `json:"id"`
 	ProductName   string    `json:"product_name"`
@@ -16,16 +24,77 @@ type Product struct {
 	Price         float64   `json:"price"`
 	CreatedAt     time.Time `json:"-"`
 	UpdatedAt     time.Time `json:"-"`
+	// Version is incremented on every write, it is sent as the ETag
+	Version int `json:"-"`
+	// DeletedAt is set while the product is in the trash, the reads skip it
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// ProductChanges are the fields of a product to update, nil fields are kept
+type ProductChanges struct {
+	ProductName   *string
+	Category      *string
+	StockQuantity *int
+	Price         *float64
+}
+
+// IsEmpty reports whether no field changes
+func (c ProductChanges) IsEmpty() bool {
+	return c.ProductName == nil && c.Category == nil && c.StockQuantity == nil && c.Price == nil
+}
+
+// ProductRepository stores the products of the catalog
+type ProductRepository interface {
+	CreateProduct(ctx context.Context, product *Product) (*Product, error)
+	// UpdateProductField only updates the non zero fields of product. When
+	// product.Version is set, it returns ErrVersionMismatch if the stored
+	// version differs.
+	UpdateProductField(ctx context.Context, product *Product) (*Product, error)
+	// PatchProduct updates the fields set in changes, zero values included,
+	// when the product is still at version (0 for any)
+	PatchProduct(ctx context.Context, id, version int, changes ProductChanges) (*Product, error)
+	GetProducts(ctx context.Context) ([]Product, error)
+	GetProductByID(ctx context.Context, id int) (Product, error)
+	GetTotalProductsCount(ctx context.Context) (int, error)
+	// CountProducts counts the products matching filter
+	CountProducts(ctx context.Context, filter ProductFilter) (int, error)
+	// PaginateData returns a page of the products of query
+	PaginateData(ctx context.Context, query ProductQuery, pagenumber, limit int) ([]Product, error)
+	// ListProducts returns up to limit products of query listed after
+	// query.After, or the last ones before query.Before, in the listing order.
+	// The products have their timestamps, for ProductQuery.KeyOf.
+	ListProducts(ctx context.Context, query ProductQuery, limit int) ([]Product, error)
+	// DeleteProduct moves a product at version (0 for any) to the trash, it
+	// returns ErrNotFound when the product does not exist or is already deleted
+	DeleteProduct(ctx context.Context, id, version int) error
+	// GetDeletedProducts lists the products in the trash, last deleted first
+	GetDeletedProducts(ctx context.Context) ([]Product, error)
+	// RestoreProduct takes a product out of the trash
+	RestoreProduct(ctx context.Context, id int) (*Product, error)
+	// PurgeProduct removes a deleted product for good
+	PurgeProduct(ctx context.Context, id int) error
+	// PurgeDeletedProducts removes the products deleted before a time and
+	// returns how many were removed
+	PurgeDeletedProducts(ctx context.Context, deletedBefore time.Time) (int64, error)
 }
 
-func CreateProduct(product *Product) (*Product, error) {
+type PostgresProductRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresProductRepository(db *sql.DB) *PostgresProductRepository {
+	return &PostgresProductRepository{db: db}
+}
+
+func (r *PostgresProductRepository) CreateProduct(ctx context.Context, product *Product) (*Product, error) {
 	var productID int
 	// Modify the query to return the ID and created_at timestamp
-	query := "INSERT INTO products (product_name, category, stock_quantity, price) VALUES ($1, $2, $3, $4) RETURNING product_id"
+	var version int
+	query := "INSERT INTO products (product_name, category, stock_quantity, price) VALUES ($1, $2, $3, $4) RETURNING product_id, version"
 
 	// Execute the query and get the new product's ID
-	err := DB.QueryRow(query, product.ProductName, product.Category, product.StockQuantity, product.Price).
-		Scan(&productID)
+	err := r.db.QueryRowContext(ctx, query, product.ProductName, product.Category, product.StockQuantity, product.Price).
+		Scan(&productID, &version)
 	if err != nil {
 		return nil, fmt.Errorf("could not create product: %v", err)
 	}
@@ -37,71 +106,102 @@ func CreateProduct(product *Product) (*Product, error) {
 		Category:      product.Category,
 		StockQuantity: product.StockQuantity,
 		Price:         product.Price,
+		Version:       version,
 	}
 	return productResponse, nil
 }
 
-func UpdateProductField(product *Product) (*Product, error) {
+func (r *PostgresProductRepository) UpdateProductField(ctx context.Context, product *Product) (*Product, error) {
 	var updatedProduct Product
 
-	//	query := `UPDATE products
-	//        SET product_name = COALESCE($1, product_name),
-	//            category = COALESCE($2, category),
-	//            stock_quantity = COALESCE($3, stock_quantity),
-	//            price = COALESCE($4, price),
-	//            updated_at = NOW()
-	//        WHERE product_id = $5
-	//        RETURNING product_id, product_name, category, stock_quantity, price, updated_at;`
 	query := `UPDATE products
-        SET 
+        SET
             product_name = COALESCE(NULLIF($1, ''), product_name),
             category = COALESCE(NULLIF($2, ''), category),
             stock_quantity = COALESCE(NULLIF($3, 0), stock_quantity),
             price = COALESCE(NULLIF($4, 0), price),
-            updated_at = NOW()
-        WHERE product_id = $5
-        RETURNING product_id, product_name, category, stock_quantity, price, updated_at;`
+            updated_at = NOW(),
+            version = version + 1
+        WHERE product_id = $5 AND deleted_at IS NULL AND ($6 = 0 OR version = $6)
+        RETURNING product_id, product_name, category, stock_quantity, price, updated_at, version;`
 
 	// Execute the query
-	err := DB.QueryRow(query, product.ProductName, product.Category, product.StockQuantity, product.Price, product.ID).
-		Scan(&updatedProduct.ID, &updatedProduct.ProductName, &updatedProduct.Category, &updatedProduct.StockQuantity, &updatedProduct.Price, &updatedProduct.UpdatedAt)
-	if err != nil {
+	err := r.db.QueryRowContext(ctx, query, product.ProductName, product.Category, product.StockQuantity, product.Price, product.ID, product.Version).
+		Scan(&updatedProduct.ID, &updatedProduct.ProductName, &updatedProduct.Category, &updatedProduct.StockQuantity, &updatedProduct.Price, &updatedProduct.UpdatedAt, &updatedProduct.Version)
+	if err == sql.ErrNoRows {
+		return nil, r.notFoundOrChanged(ctx, product.ID, product.Version)
+	} else if err != nil {
 		return nil, fmt.Errorf("could not update product: %v", err)
 	}
 	// Return the updated product details
 	return &updatedProduct, nil
 }
 
-//
-//func AddTryProduct(product *Product) (*Product, error) {
-//	var err error
-//	query := "INSERT INTO products (product_name, category, stock_quantity, price) VALUES ($1, $2, $3, $4)"
-//	err = DB.QueryRow(
-//		query,
-//		product.ProductName,
-//		product.Category,
-//		product.StockQuantity,
-//		product.Price,
-//	)
-//	if err != nil {
-//		return &Product{}, fmt.Errorf("could not create user")
-//	}
-//
-//	productResponse := &Product{
-//		ProductName:   product.ProductName,
-//		Category:      product.Category,
-//		StockQuantity: product.StockQuantity,
-//		Price:         product.Price,
-//	}
-//	return productResponse, nil
-//}
+// notFoundOrChanged tells why a write expecting version matched no product
+func (r *PostgresProductRepository) notFoundOrChanged(ctx context.Context, id, version int) error {
+	if version == 0 {
+		return ErrNotFound
+	}
+	if _, err := r.GetProductByID(ctx, id); err != nil {
+		return err
+	}
+	return ErrVersionMismatch
+}
+
+func (r *PostgresProductRepository) PatchProduct(ctx context.Context, id, version int, changes ProductChanges) (*Product, error) {
+	if changes.IsEmpty() {
+		product, err := r.GetProductByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if version != 0 && product.Version != version {
+			return nil, ErrVersionMismatch
+		}
+		return &product, nil
+	}
+
+	// Only the changed columns are written
+	var sets []string
+	var args []any
+	set := func(column string, value any) {
+		args = append(args, value)
+		sets = append(sets, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+	if changes.ProductName != nil {
+		set("product_name", *changes.ProductName)
+	}
+	if changes.Category != nil {
+		set("category", *changes.Category)
+	}
+	if changes.StockQuantity != nil {
+		set("stock_quantity", *changes.StockQuantity)
+	}
+	if changes.Price != nil {
+		set("price", *changes.Price)
+	}
+	args = append(args, id, version)
+
+	var product Product
+	query := fmt.Sprintf(`UPDATE products SET %s, updated_at = NOW(), version = version + 1
+        WHERE product_id = $%d AND deleted_at IS NULL AND ($%d = 0 OR version = $%d)
+        RETURNING product_id, product_name, category, stock_quantity, price, updated_at, version`,
+		strings.Join(sets, ", "), len(args)-1, len(args), len(args))
+	err := r.db.QueryRowContext(ctx, query, args...).
+		Scan(&product.ID, &product.ProductName, &product.Category, &product.StockQuantity, &product.Price, &product.UpdatedAt, &product.Version)
+	if err == sql.ErrNoRows {
+		return nil, r.notFoundOrChanged(ctx, id, version)
+	} else if err != nil {
+		return nil, fmt.Errorf("could not update product: %v", err)
+	}
+	return &product, nil
+}
 
 // Get all products
-func GetProducts() ([]Product, error) {
+func (r *PostgresProductRepository) GetProducts(ctx context.Context) ([]Product, error) {
 	var err error
 
-	query := "SELECT product_id, product_name, category, stock_quantity, price FROM products"
-	rows, err := DB.Query(query)
+	query := "SELECT product_id, product_name, category, stock_quantity, price FROM products WHERE deleted_at IS NULL"
+	rows, err := r.db.QueryContext(ctx, query)
 	if err != nil {
 		return []Product{}, err
 	}
@@ -118,19 +218,19 @@ func GetProducts() ([]Product, error) {
 		// append the data to products
 		products = append(products, product)
 	}
-	return products, nil
+	return products, rows.Err()
 }
 
 // Get product by id
-func GetProductByID(id int) (Product, error) {
+func (r *PostgresProductRepository) GetProductByID(ctx context.Context, id int) (Product, error) {
 	var err error
 	var product Product
-	query := "SELECT product_id, product_name, category, stock_quantity, price FROM products where product_id=$1"
-	err = DB.QueryRow(query, id).
-		Scan(&product.ID, &product.ProductName, &product.Category, &product.StockQuantity, &product.Price)
+	query := "SELECT product_id, product_name, category, stock_quantity, price, version FROM products WHERE product_id = $1 AND deleted_at IS NULL"
+	err = r.db.QueryRowContext(ctx, query, id).
+		Scan(&product.ID, &product.ProductName, &product.Category, &product.StockQuantity, &product.Price, &product.Version)
 
 	if err == sql.ErrNoRows {
-		return Product{}, err
+		return Product{}, ErrNotFound
 	} else if err != nil {
 		return Product{}, err
 	}
@@ -139,26 +239,46 @@ func GetProductByID(id int) (Product, error) {
 	return product, nil
 }
 
-func GetTotalProductsCount() (int, error) {
+func (r *PostgresProductRepository) GetTotalProductsCount(ctx context.Context) (int, error) {
 	var err error
 	var totalProduct int
-	query := "SELECT COUNT(*) FROM products"
-	err = DB.QueryRow(query).Scan(&totalProduct)
+	query := "SELECT COUNT(*) FROM products WHERE deleted_at IS NULL"
+	err = r.db.QueryRowContext(ctx, query).Scan(&totalProduct)
 	if err != nil {
 		return 0, err
 	}
 	return totalProduct, nil
 }
 
-func PaginateData(pagenumber, limit int) ([]Product, error) {
+func (r *PostgresProductRepository) CountProducts(ctx context.Context, filter ProductFilter) (int, error) {
+	var count int
+	where, args := filter.where()
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM products WHERE "+where, args...).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (r *PostgresProductRepository) PaginateData(ctx context.Context, productQuery ProductQuery, pagenumber, limit int) ([]Product, error) {
 	var offset int
 
 	// Set offset, offset specifies the number of items to skip before starting to display results
 	offset = (pagenumber - 1) * limit
 
-	query := "SELECT product_id, product_name, category, stock_quantity, price FROM products LIMIT $1 OFFSET $2"
-	rows, err := DB.Query(query, limit, offset)
-
+	// The filter and the sort are compiled to parameters and whitelisted columns
+	where, args := productQuery.Filter.where()
+	orderBy, err := productQuery.orderBy(false)
+	if err != nil {
+		return []Product{}, err
+	}
+	args = append(args, limit, offset)
+	query := fmt.Sprintf("SELECT product_id, product_name, category, stock_quantity, price FROM products WHERE %s ORDER BY %s LIMIT $%d OFFSET $%d",
+		where, orderBy, len(args)-1, len(args))
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return []Product{}, err
+	}
 	defer rows.Close()
 
 	var products []Product
@@ -181,14 +301,117 @@ func PaginateData(pagenumber, limit int) ([]Product, error) {
 	return products, nil
 }
 
-//func UpdateProduct(product *Product) (*Product, error) {
-//	var product Product
-//	/*
-//	   query := // Update Query here
-//	   updateQuery :=
-//
-//	   query = // Fetch Query here
-//	   fetchQuery
-//	*/
-//	return &product, nil
-//}
+func (r *PostgresProductRepository) ListProducts(ctx context.Context, productQuery ProductQuery, limit int) ([]Product, error) {
+	key, backward, err := productQuery.seek()
+	if err != nil {
+		return nil, err
+	}
+	where, args := productQuery.Filter.where()
+	if key != nil {
+		var seek string
+		if seek, args, err = productQuery.keyset(*key, backward, args); err != nil {
+			return nil, err
+		}
+		where += " AND " + seek
+	}
+	orderBy, err := productQuery.orderBy(backward)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, limit)
+	query := fmt.Sprintf(`SELECT product_id, product_name, category, stock_quantity, price, created_at, updated_at
+        FROM products WHERE %s ORDER BY %s LIMIT $%d`, where, orderBy, len(args))
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not list products: %v", err)
+	}
+	defer rows.Close()
+
+	products := []Product{}
+	for rows.Next() {
+		var product Product
+		if err := rows.Scan(&product.ID, &product.ProductName, &product.Category, &product.StockQuantity, &product.Price, &product.CreatedAt, &product.UpdatedAt); err != nil {
+			return nil, err
+		}
+		products = append(products, product)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if backward {
+		slices.Reverse(products)
+	}
+	return products, nil
+}
+
+func (r *PostgresProductRepository) DeleteProduct(ctx context.Context, id, version int) error {
+	query := `UPDATE products SET deleted_at = NOW(), updated_at = NOW(), version = version + 1
+        WHERE product_id = $1 AND deleted_at IS NULL AND ($2 = 0 OR version = $2)`
+	result, err := r.db.ExecContext(ctx, query, id, version)
+	if err != nil {
+		return fmt.Errorf("could not delete product: %v", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return r.notFoundOrChanged(ctx, id, version)
+	}
+	return nil
+}
+
+func (r *PostgresProductRepository) GetDeletedProducts(ctx context.Context) ([]Product, error) {
+	query := `SELECT product_id, product_name, category, stock_quantity, price, deleted_at
+        FROM products WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC, product_id`
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := []Product{}
+	for rows.Next() {
+		var product Product
+		err := rows.Scan(&product.ID, &product.ProductName, &product.Category, &product.StockQuantity, &product.Price, &product.DeletedAt)
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, product)
+	}
+	return products, rows.Err()
+}
+
+func (r *PostgresProductRepository) RestoreProduct(ctx context.Context, id int) (*Product, error) {
+	var product Product
+	query := `UPDATE products SET deleted_at = NULL, updated_at = NOW(), version = version + 1
+        WHERE product_id = $1 AND deleted_at IS NOT NULL
+        RETURNING product_id, product_name, category, stock_quantity, price, updated_at, version`
+	err := r.db.QueryRowContext(ctx, query, id).
+		Scan(&product.ID, &product.ProductName, &product.Category, &product.StockQuantity, &product.Price, &product.UpdatedAt, &product.Version)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("could not restore product: %v", err)
+	}
+	return &product, nil
+}
+
+func (r *PostgresProductRepository) PurgeProduct(ctx context.Context, id int) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM products WHERE product_id = $1 AND deleted_at IS NOT NULL", id)
+	if err != nil {
+		return fmt.Errorf("could not purge product: %v", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *PostgresProductRepository) PurgeDeletedProducts(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM products WHERE deleted_at < $1", deletedBefore)
+	if err != nil {
+		return 0, fmt.Errorf("could not purge products: %v", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,351 @@
+package database
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryProductRepository keeps the products in memory, ordered by id like
+// the postgres serial column
+type MemoryProductRepository struct {
+	mu       sync.RWMutex
+	nextID   int
+	products map[int]Product
+}
+
+func NewMemoryProductRepository() *MemoryProductRepository {
+	return &MemoryProductRepository{nextID: 1, products: map[int]Product{}}
+}
+
+func (r *MemoryProductRepository) CreateProduct(ctx context.Context, product *Product) (*Product, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	stored := Product{
+		ID:            r.nextID,
+		ProductName:   product.ProductName,
+		Category:      product.Category,
+		StockQuantity: product.StockQuantity,
+		Price:         product.Price,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		Version:       1,
+	}
+	r.products[stored.ID] = stored
+	r.nextID++
+
+	return &Product{
+		ID:            stored.ID,
+		ProductName:   stored.ProductName,
+		Category:      stored.Category,
+		StockQuantity: stored.StockQuantity,
+		Price:         stored.Price,
+		Version:       stored.Version,
+	}, nil
+}
+
+func (r *MemoryProductRepository) UpdateProductField(ctx context.Context, product *Product) (*Product, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.products[product.ID]
+	if !ok || stored.DeletedAt != nil {
+		return nil, ErrNotFound
+	}
+	if product.Version != 0 && stored.Version != product.Version {
+		return nil, ErrVersionMismatch
+	}
+
+	// Same as COALESCE(NULLIF(...)) in postgres, zero values keep the stored field
+	if product.ProductName != "" {
+		stored.ProductName = product.ProductName
+	}
+	if product.Category != "" {
+		stored.Category = product.Category
+	}
+	if product.StockQuantity != 0 {
+		stored.StockQuantity = product.StockQuantity
+	}
+	if product.Price != 0 {
+		stored.Price = product.Price
+	}
+	stored.UpdatedAt = time.Now()
+	stored.Version++
+	r.products[stored.ID] = stored
+
+	return &Product{
+		ID:            stored.ID,
+		ProductName:   stored.ProductName,
+		Category:      stored.Category,
+		StockQuantity: stored.StockQuantity,
+		Price:         stored.Price,
+		UpdatedAt:     stored.UpdatedAt,
+		Version:       stored.Version,
+	}, nil
+}
+
+func (r *MemoryProductRepository) PatchProduct(ctx context.Context, id, version int, changes ProductChanges) (*Product, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.products[id]
+	if !ok || stored.DeletedAt != nil {
+		return nil, ErrNotFound
+	}
+	if version != 0 && stored.Version != version {
+		return nil, ErrVersionMismatch
+	}
+	if changes.IsEmpty() {
+		product := listed(stored)
+		return &product, nil
+	}
+
+	if changes.ProductName != nil {
+		stored.ProductName = *changes.ProductName
+	}
+	if changes.Category != nil {
+		stored.Category = *changes.Category
+	}
+	if changes.StockQuantity != nil {
+		stored.StockQuantity = *changes.StockQuantity
+	}
+	if changes.Price != nil {
+		stored.Price = *changes.Price
+	}
+	stored.UpdatedAt = time.Now()
+	stored.Version++
+	r.products[id] = stored
+
+	product := listed(stored)
+	product.UpdatedAt = stored.UpdatedAt
+	return &product, nil
+}
+
+func (r *MemoryProductRepository) GetProducts(ctx context.Context) ([]Product, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.sorted(), nil
+}
+
+func (r *MemoryProductRepository) GetProductByID(ctx context.Context, id int) (Product, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	product, ok := r.products[id]
+	if !ok || product.DeletedAt != nil {
+		return Product{}, ErrNotFound
+	}
+	return listed(product), nil
+}
+
+func (r *MemoryProductRepository) GetTotalProductsCount(ctx context.Context) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return len(r.sorted()), nil
+}
+
+func (r *MemoryProductRepository) CountProducts(ctx context.Context, filter ProductFilter) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var count int
+	for _, product := range r.products {
+		if filter.matches(product) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *MemoryProductRepository) PaginateData(ctx context.Context, query ProductQuery, pagenumber, limit int) ([]Product, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if _, err := query.orderBy(false); err != nil {
+		return []Product{}, err
+	}
+	var products []Product
+	for _, product := range r.products {
+		if query.Filter.matches(product) {
+			products = append(products, product)
+		}
+	}
+	sort.Slice(products, func(i, j int) bool {
+		return query.compare(products[i], products[j]) < 0
+	})
+	offset := (pagenumber - 1) * limit
+	if offset < 0 || offset >= len(products) {
+		return nil, nil
+	}
+	end := offset + limit
+	if end > len(products) {
+		end = len(products)
+	}
+	page := make([]Product, 0, end-offset)
+	for _, product := range products[offset:end] {
+		page = append(page, listed(product))
+	}
+	return page, nil
+}
+
+func (r *MemoryProductRepository) ListProducts(ctx context.Context, query ProductQuery, limit int) ([]Product, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	key, backward, err := query.seek()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := query.orderBy(backward); err != nil {
+		return nil, err
+	}
+	if key != nil {
+		if err := query.checkKey(*key); err != nil {
+			return nil, err
+		}
+	}
+
+	products := []Product{}
+	for _, product := range r.products {
+		if !query.Filter.matches(product) {
+			continue
+		}
+		if key != nil {
+			c := query.compare(product, key.product())
+			if backward && c >= 0 || !backward && c <= 0 {
+				continue
+			}
+		}
+		listedProduct := listed(product)
+		listedProduct.CreatedAt = product.CreatedAt
+		listedProduct.UpdatedAt = product.UpdatedAt
+		products = append(products, listedProduct)
+	}
+	sort.Slice(products, func(i, j int) bool {
+		return query.compare(products[i], products[j]) < 0
+	})
+	if len(products) > limit {
+		if backward {
+			products = products[len(products)-limit:]
+		} else {
+			products = products[:limit]
+		}
+	}
+	return products, nil
+}
+
+func (r *MemoryProductRepository) DeleteProduct(ctx context.Context, id, version int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	product, ok := r.products[id]
+	if !ok || product.DeletedAt != nil {
+		return ErrNotFound
+	}
+	if version != 0 && product.Version != version {
+		return ErrVersionMismatch
+	}
+	now := time.Now()
+	product.DeletedAt = &now
+	product.UpdatedAt = now
+	product.Version++
+	r.products[id] = product
+	return nil
+}
+
+func (r *MemoryProductRepository) GetDeletedProducts(ctx context.Context) ([]Product, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	products := []Product{}
+	for _, product := range r.products {
+		if product.DeletedAt != nil {
+			deleted := listed(product)
+			deleted.DeletedAt = product.DeletedAt
+			products = append(products, deleted)
+		}
+	}
+	sort.Slice(products, func(i, j int) bool {
+		if !products[i].DeletedAt.Equal(*products[j].DeletedAt) {
+			return products[i].DeletedAt.After(*products[j].DeletedAt)
+		}
+		return products[i].ID < products[j].ID
+	})
+	return products, nil
+}
+
+func (r *MemoryProductRepository) RestoreProduct(ctx context.Context, id int) (*Product, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	product, ok := r.products[id]
+	if !ok || product.DeletedAt == nil {
+		return nil, ErrNotFound
+	}
+	product.DeletedAt = nil
+	product.UpdatedAt = time.Now()
+	product.Version++
+	r.products[id] = product
+
+	restored := listed(product)
+	restored.UpdatedAt = product.UpdatedAt
+	return &restored, nil
+}
+
+func (r *MemoryProductRepository) PurgeProduct(ctx context.Context, id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	product, ok := r.products[id]
+	if !ok || product.DeletedAt == nil {
+		return ErrNotFound
+	}
+	delete(r.products, id)
+	return nil
+}
+
+func (r *MemoryProductRepository) PurgeDeletedProducts(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var purged int64
+	for id, product := range r.products {
+		if product.DeletedAt != nil && product.DeletedAt.Before(deletedBefore) {
+			delete(r.products, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// sorted returns the products not deleted ordered by id, nil when there are
+// none like the postgres implementation
+func (r *MemoryProductRepository) sorted() []Product {
+	var products []Product
+	for _, product := range r.products {
+		if product.DeletedAt == nil {
+			products = append(products, listed(product))
+		}
+	}
+	sort.Slice(products, func(i, j int) bool {
+		return products[i].ID < products[j].ID
+	})
+	return products
+}
+
+// listed returns the fields selected by the postgres read queries
+func listed(product Product) Product {
+	return Product{
+		ID:            product.ID,
+		ProductName:   product.ProductName,
+		Category:      product.Category,
+		StockQuantity: product.StockQuantity,
+		Price:         product.Price,
+		Version:       product.Version,
+	}
+}
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPurgeDeletedProducts(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryProductRepository()
+	cutoff := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	for name, at := range map[string]time.Time{
+		"old":    cutoff.Add(-time.Hour),
+		"cutoff": cutoff,
+		"recent": cutoff.Add(time.Hour),
+		"live":   {},
+	} {
+		product, err := repo.CreateProduct(ctx, &Product{ProductName: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !at.IsZero() {
+			stored := repo.products[product.ID]
+			stored.DeletedAt = &at
+			repo.products[product.ID] = stored
+		}
+	}
+
+	purged, err := repo.PurgeDeletedProducts(ctx, cutoff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 1 {
+		t.Errorf("purged %d products, want 1", purged)
+	}
+
+	kept := map[string]bool{}
+	for _, product := range repo.products {
+		kept[product.ProductName] = true
+	}
+	for name, want := range map[string]bool{"old": false, "cutoff": true, "recent": true, "live": true} {
+		if kept[name] != want {
+			t.Errorf("%s kept: got %v, want %v", name, kept[name], want)
+		}
+	}
+
+	// A live product is not purged, even one by one
+	for _, product := range repo.products {
+		if product.ProductName == "live" {
+			if err := repo.PurgeProduct(ctx, product.ID); !errors.Is(err, ErrNotFound) {
+				t.Errorf("purging the live product: got %v, want ErrNotFound", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,362 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProductFilter selects the products of a listing, zero fields match every
+// product
+type ProductFilter struct {
+	// Category matches the category exactly
+	Category *string
+	// MinPrice and MaxPrice bound the price, both inclusive
+	MinPrice *float64
+	MaxPrice *float64
+	// InStock matches the products with a stock above 0, or of 0 when false
+	InStock *bool
+	// NameContains matches the names containing it, ignoring the case
+	NameContains string
+	// CreatedAfter and UpdatedAfter are inclusive, CreatedBefore and
+	// UpdatedBefore exclusive
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	UpdatedAfter  *time.Time
+	UpdatedBefore *time.Time
+}
+
+// ProductSort orders a listing by a field of ProductSortFields
+type ProductSort struct {
+	Field string
+	Desc  bool
+}
+
+// ProductQuery is a filtered and sorted product listing. The products are
+// always ordered by id last, so the order is the same between pages.
+type ProductQuery struct {
+	Filter ProductFilter
+	Sort   []ProductSort
+	// After and Before seek the products listed after or before a key, for
+	// the keyset pagination of ListProducts
+	After  *ProductKey
+	Before *ProductKey
+}
+
+// ProductKey is the position of a product in a listing: its id and the fields
+// the listing is sorted by, the other fields are nil
+type ProductKey struct {
+	ID            int        `json:"id"`
+	ProductName   *string    `json:"product_name,omitempty"`
+	Category      *string    `json:"category,omitempty"`
+	StockQuantity *int       `json:"stock_quantity,omitempty"`
+	Price         *float64   `json:"price,omitempty"`
+	CreatedAt     *time.Time `json:"created_at,omitempty"`
+	UpdatedAt     *time.Time `json:"updated_at,omitempty"`
+}
+
+// KeyOf returns the key of a product listed by ListProducts
+func (q ProductQuery) KeyOf(product Product) ProductKey {
+	key := ProductKey{ID: product.ID}
+	for _, s := range q.Sort {
+		switch s.Field {
+		case "product_name":
+			key.ProductName = &product.ProductName
+		case "category":
+			key.Category = &product.Category
+		case "stock_quantity":
+			key.StockQuantity = &product.StockQuantity
+		case "price":
+			key.Price = &product.Price
+		case "created_at":
+			key.CreatedAt = &product.CreatedAt
+		case "updated_at":
+			key.UpdatedAt = &product.UpdatedAt
+		}
+	}
+	return key
+}
+
+// value returns the value of a sort field in the key, false when it is missing
+func (k ProductKey) value(field string) (any, bool) {
+	switch field {
+	case "id":
+		return k.ID, true
+	case "product_name":
+		return deref(k.ProductName)
+	case "category":
+		return deref(k.Category)
+	case "stock_quantity":
+		return deref(k.StockQuantity)
+	case "price":
+		return deref(k.Price)
+	case "created_at":
+		return deref(k.CreatedAt)
+	case "updated_at":
+		return deref(k.UpdatedAt)
+	}
+	return nil, false
+}
+
+func deref[T any](value *T) (any, bool) {
+	if value == nil {
+		return nil, false
+	}
+	return *value, true
+}
+
+// product returns a product with the fields of the key, to compare it in memory
+func (k ProductKey) product() Product {
+	product := Product{ID: k.ID}
+	if k.ProductName != nil {
+		product.ProductName = *k.ProductName
+	}
+	if k.Category != nil {
+		product.Category = *k.Category
+	}
+	if k.StockQuantity != nil {
+		product.StockQuantity = *k.StockQuantity
+	}
+	if k.Price != nil {
+		product.Price = *k.Price
+	}
+	if k.CreatedAt != nil {
+		product.CreatedAt = *k.CreatedAt
+	}
+	if k.UpdatedAt != nil {
+		product.UpdatedAt = *k.UpdatedAt
+	}
+	return product
+}
+
+// productSortColumns maps the sortable fields to their column, only these
+// names ever end up in an ORDER BY
+var productSortColumns = map[string]string{
+	"id":             "product_id",
+	"product_name":   "product_name",
+	"category":       "category",
+	"stock_quantity": "stock_quantity",
+	"price":          "price",
+	"created_at":     "created_at",
+	"updated_at":     "updated_at",
+}
+
+// ProductSortFields lists the fields a product listing can be sorted by
+func ProductSortFields() []string {
+	fields := make([]string, 0, len(productSortColumns))
+	for field := range productSortColumns {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// ParseProductSort parses a comma separated list of fields, a leading - sorts
+// a field in descending order: -price,product_name
+func ParseProductSort(value string) ([]ProductSort, error) {
+	var sorts []ProductSort
+	seen := map[string]bool{}
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		desc := strings.HasPrefix(field, "-")
+		field = strings.TrimPrefix(field, "-")
+		if _, ok := productSortColumns[field]; !ok {
+			return nil, fmt.Errorf("cannot sort by %q, use one of %s", field, strings.Join(ProductSortFields(), ", "))
+		}
+		if seen[field] {
+			return nil, fmt.Errorf("%s is sorted twice", field)
+		}
+		seen[field] = true
+		sorts = append(sorts, ProductSort{Field: field, Desc: desc})
+	}
+	return sorts, nil
+}
+
+// where compiles the filter to a WHERE clause of the live products, the
+// values are passed as parameters numbered from $1
+func (f ProductFilter) where() (string, []any) {
+	conditions := []string{"deleted_at IS NULL"}
+	var args []any
+	add := func(condition string, value any) {
+		args = append(args, value)
+		conditions = append(conditions, strings.ReplaceAll(condition, "?", "$"+strconv.Itoa(len(args))))
+	}
+
+	if f.Category != nil {
+		add("category = ?", *f.Category)
+	}
+	if f.MinPrice != nil {
+		add("price >= ?", *f.MinPrice)
+	}
+	if f.MaxPrice != nil {
+		add("price <= ?", *f.MaxPrice)
+	}
+	if f.InStock != nil {
+		if *f.InStock {
+			conditions = append(conditions, "stock_quantity > 0")
+		} else {
+			conditions = append(conditions, "stock_quantity = 0")
+		}
+	}
+	if f.NameContains != "" {
+		// The LIKE wildcards of the search are matched literally
+		escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(f.NameContains)
+		add("product_name ILIKE ?", "%"+escaped+"%")
+	}
+	if f.CreatedAfter != nil {
+		add("created_at >= ?", *f.CreatedAfter)
+	}
+	if f.CreatedBefore != nil {
+		add("created_at < ?", *f.CreatedBefore)
+	}
+	if f.UpdatedAfter != nil {
+		add("updated_at >= ?", *f.UpdatedAfter)
+	}
+	if f.UpdatedBefore != nil {
+		add("updated_at < ?", *f.UpdatedBefore)
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// order returns the sort of the listing ending with the id, the fields after
+// the unique id never change the order
+func (q ProductQuery) order() ([]ProductSort, error) {
+	var order []ProductSort
+	for _, s := range q.Sort {
+		if _, ok := productSortColumns[s.Field]; !ok {
+			return nil, fmt.Errorf("cannot sort by %q", s.Field)
+		}
+		order = append(order, s)
+		if s.Field == "id" {
+			return order, nil
+		}
+	}
+	return append(order, ProductSort{Field: "id"}), nil
+}
+
+// seek returns the key the listing starts from and whether the products are
+// read backwards, from the key up to the first product
+func (q ProductQuery) seek() (*ProductKey, bool, error) {
+	switch {
+	case q.After != nil && q.Before != nil:
+		return nil, false, fmt.Errorf("cannot seek both after and before a product")
+	case q.Before != nil:
+		return q.Before, true, nil
+	}
+	return q.After, false, nil
+}
+
+// orderBy compiles the sort to an ORDER BY clause ending with the id, in
+// reverse when backward
+func (q ProductQuery) orderBy(backward bool) (string, error) {
+	order, err := q.order()
+	if err != nil {
+		return "", err
+	}
+	terms := make([]string, len(order))
+	for i, s := range order {
+		terms[i] = productSortColumns[s.Field]
+		if s.Desc != backward {
+			terms[i] += " DESC"
+		}
+	}
+	return strings.Join(terms, ", "), nil
+}
+
+// checkKey returns an error when key misses a field of the sort
+func (q ProductQuery) checkKey(key ProductKey) error {
+	order, err := q.order()
+	if err != nil {
+		return err
+	}
+	for _, s := range order {
+		if _, ok := key.value(s.Field); !ok {
+			return fmt.Errorf("the key has no %s", s.Field)
+		}
+	}
+	return nil
+}
+
+// keyset compiles the condition of the products listed after key, or before
+// it when backward, with parameters numbered after args. As the fields can be
+// sorted in different directions, it expands to
+// (a > $1) OR (a = $1 AND b < $2) OR (a = $1 AND b = $2 AND id > $3).
+func (q ProductQuery) keyset(key ProductKey, backward bool, args []any) (string, []any, error) {
+	if err := q.checkKey(key); err != nil {
+		return "", nil, err
+	}
+	order, _ := q.order()
+	var equal, alternatives []string
+	for _, s := range order {
+		value, _ := key.value(s.Field)
+		args = append(args, value)
+		column, param := productSortColumns[s.Field], "$"+strconv.Itoa(len(args))
+		operator := ">"
+		if s.Desc != backward {
+			operator = "<"
+		}
+		alternatives = append(alternatives, "("+strings.Join(append(equal, column+" "+operator+" "+param), " AND ")+")")
+		equal = append(equal, column+" = "+param)
+	}
+	return "(" + strings.Join(alternatives, " OR ") + ")", args, nil
+}
+
+// matches is the in memory version of where
+func (f ProductFilter) matches(product Product) bool {
+	switch {
+	case product.DeletedAt != nil,
+		f.Category != nil && product.Category != *f.Category,
+		f.MinPrice != nil && product.Price < *f.MinPrice,
+		f.MaxPrice != nil && product.Price > *f.MaxPrice,
+		f.InStock != nil && (product.StockQuantity > 0) != *f.InStock,
+		f.NameContains != "" && !strings.Contains(strings.ToLower(product.ProductName), strings.ToLower(f.NameContains)),
+		f.CreatedAfter != nil && product.CreatedAt.Before(*f.CreatedAfter),
+		f.CreatedBefore != nil && !product.CreatedAt.Before(*f.CreatedBefore),
+		f.UpdatedAfter != nil && product.UpdatedAt.Before(*f.UpdatedAfter),
+		f.UpdatedBefore != nil && !product.UpdatedAt.Before(*f.UpdatedBefore):
+		return false
+	}
+	return true
+}
+
+// compare is the in memory version of orderBy, it returns a negative number
+// when a is listed first
+func (q ProductQuery) compare(a, b Product) int {
+	for _, s := range q.Sort {
+		c := compareField(s.Field, a, b)
+		if s.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return a.ID - b.ID
+}
+
+func compareField(field string, a, b Product) int {
+	switch field {
+	case "id":
+		return a.ID - b.ID
+	case "product_name":
+		return strings.Compare(a.ProductName, b.ProductName)
+	case "category":
+		return strings.Compare(a.Category, b.Category)
+	case "stock_quantity":
+		return a.StockQuantity - b.StockQuantity
+	case "price":
+		switch {
+		case a.Price < b.Price:
+			return -1
+		case a.Price > b.Price:
+			return 1
+		}
+	case "created_at":
+		return a.CreatedAt.Compare(b.CreatedAt)
+	case "updated_at":
+		return a.UpdatedAt.Compare(b.UpdatedAt)
+	}
+	return 0
+}
@@ -0,0 +1,197 @@
+package database
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestProductFilterWhere(t *testing.T) {
+	category, minPrice, inStock, outOfStock := "shoes", 10.5, true, false
+	after := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		filter ProductFilter
+		where  string
+		args   []any
+	}{
+		{"none", ProductFilter{}, "deleted_at IS NULL", nil},
+		{
+			"numbered parameters",
+			ProductFilter{Category: &category, MinPrice: &minPrice, CreatedAfter: &after},
+			"deleted_at IS NULL AND category = $1 AND price >= $2 AND created_at >= $3",
+			[]any{"shoes", 10.5, after},
+		},
+		{"in stock", ProductFilter{InStock: &inStock}, "deleted_at IS NULL AND stock_quantity > 0", nil},
+		{"out of stock", ProductFilter{InStock: &outOfStock, MaxPrice: &minPrice}, "deleted_at IS NULL AND price <= $1 AND stock_quantity = 0", []any{10.5}},
+		{"escaped wildcards", ProductFilter{NameContains: `50%_off\`}, "deleted_at IS NULL AND product_name ILIKE $1", []any{`%50\%\_off\\%`}},
+		{"half-open ranges", ProductFilter{UpdatedAfter: &after, UpdatedBefore: &after}, "deleted_at IS NULL AND updated_at >= $1 AND updated_at < $2", []any{after, after}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			where, args := test.filter.where()
+			if where != test.where {
+				t.Errorf("got %q, want %q", where, test.where)
+			}
+			if !reflect.DeepEqual(args, test.args) {
+				t.Errorf("got args %v, want %v", args, test.args)
+			}
+		})
+	}
+}
+
+func TestProductFilterMatches(t *testing.T) {
+	min, max, inStock := 10.0, 20.0, true
+	deleted := time.Now()
+	filter := ProductFilter{MinPrice: &min, MaxPrice: &max, InStock: &inStock, NameContains: "SHOE"}
+
+	tests := []struct {
+		product Product
+		want    bool
+	}{
+		{Product{ProductName: "Red shoe", Price: 10, StockQuantity: 1}, true},
+		{Product{ProductName: "Red shoe", Price: 20, StockQuantity: 1}, true},
+		{Product{ProductName: "Red shoe", Price: 20.01, StockQuantity: 1}, false},
+		{Product{ProductName: "Red shoe", Price: 15, StockQuantity: 0}, false},
+		{Product{ProductName: "Red boot", Price: 15, StockQuantity: 1}, false},
+		{Product{ProductName: "Red shoe", Price: 15, StockQuantity: 1, DeletedAt: &deleted}, false},
+	}
+	for _, test := range tests {
+		if got := filter.matches(test.product); got != test.want {
+			t.Errorf("matches(%+v) = %v, want %v", test.product, got, test.want)
+		}
+	}
+}
+
+func TestParseProductSort(t *testing.T) {
+	sorts, err := ParseProductSort("-price, product_name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ProductSort{{Field: "price", Desc: true}, {Field: "product_name"}}
+	if !reflect.DeepEqual(sorts, want) {
+		t.Errorf("got %+v, want %+v", sorts, want)
+	}
+
+	for _, value := range []string{"", "color", "price;DROP TABLE products", "price,-price", "--price"} {
+		if _, err := ParseProductSort(value); err == nil {
+			t.Errorf("ParseProductSort(%q) accepted an invalid sort", value)
+		}
+	}
+}
+
+func TestProductQueryOrderBy(t *testing.T) {
+	query := ProductQuery{Sort: []ProductSort{{Field: "price", Desc: true}, {Field: "category"}}}
+	for backward, want := range map[bool]string{
+		false: "price DESC, category, product_id",
+		true:  "price, category DESC, product_id DESC",
+	} {
+		got, err := query.orderBy(backward)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("orderBy(%v) = %q, want %q", backward, got, want)
+		}
+	}
+
+	// Sorting by id ends the order, it is unique
+	query = ProductQuery{Sort: []ProductSort{{Field: "id", Desc: true}, {Field: "price"}}}
+	if got, _ := query.orderBy(false); got != "product_id DESC" {
+		t.Errorf("got %q, want the order to stop at the id", got)
+	}
+
+	query = ProductQuery{Sort: []ProductSort{{Field: "price; DROP TABLE products"}}}
+	if _, err := query.orderBy(false); err == nil {
+		t.Error("orderBy accepted an unknown field")
+	}
+}
+
+func TestProductQueryKeyset(t *testing.T) {
+	query := ProductQuery{Sort: []ProductSort{{Field: "price", Desc: true}, {Field: "category"}}}
+	product := Product{ID: 7, Price: 9.5, Category: "hats", ProductName: "Cap"}
+	key := query.KeyOf(product)
+	if key.ProductName != nil {
+		t.Errorf("the key holds the name, the listing is not sorted by it")
+	}
+
+	where, args, err := query.keyset(key, false, []any{"shoes"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "((price < $2) OR (price = $2 AND category > $3) OR (price = $2 AND category = $3 AND product_id > $4))"
+	if where != want {
+		t.Errorf("got %q, want %q", where, want)
+	}
+	if !reflect.DeepEqual(args, []any{"shoes", 9.5, "hats", 7}) {
+		t.Errorf("got args %v", args)
+	}
+
+	where, _, _ = query.keyset(key, true, nil)
+	want = "((price > $1) OR (price = $1 AND category < $2) OR (price = $1 AND category = $2 AND product_id < $3))"
+	if where != want {
+		t.Errorf("got %q backward, want %q", where, want)
+	}
+
+	// A key of another sort is refused
+	if _, _, err := query.keyset(ProductKey{ID: 7}, false, nil); err == nil {
+		t.Error("keyset accepted a key without the sort fields")
+	}
+}
+
+func TestMemoryListProducts(t *testing.T) {
+	repo := NewMemoryProductRepository()
+	ctx := context.Background()
+	for _, product := range []Product{
+		{ProductName: "a", Price: 3},
+		{ProductName: "b", Price: 1},
+		{ProductName: "c", Price: 3},
+		{ProductName: "d", Price: 2},
+		{ProductName: "e", Price: 1},
+	} {
+		if _, err := repo.CreateProduct(ctx, &product); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	query := ProductQuery{Sort: []ProductSort{{Field: "price", Desc: true}}}
+	names := func(products []Product) []string {
+		var names []string
+		for _, product := range products {
+			names = append(names, product.ProductName)
+		}
+		return names
+	}
+
+	first, err := repo.ListProducts(ctx, query, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(first); !slices.Equal(got, []string{"a", "c"}) {
+		t.Fatalf("got %v, want a and c", got)
+	}
+
+	after := query.KeyOf(first[1])
+	query.After = &after
+	second, err := repo.ListProducts(ctx, query, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(second); !slices.Equal(got, []string{"d", "b"}) {
+		t.Fatalf("got %v after c, want d and b", got)
+	}
+
+	// Before returns the products just before the key, in the listing order
+	before := query.KeyOf(second[1])
+	query.After, query.Before = nil, &before
+	previous, err := repo.ListProducts(ctx, query, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(previous); !slices.Equal(got, []string{"c", "d"}) {
+		t.Errorf("got %v before b, want c and d", got)
+	}
+}
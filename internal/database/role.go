@@ -0,0 +1,69 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// RoleRepository stores the roles granted to each user
+type RoleRepository interface {
+	GetUserRoles(ctx context.Context, userID int) ([]string, error)
+	// GrantRole returns ErrNotFound when the user does not exist
+	GrantRole(ctx context.Context, userID int, role string) error
+	RevokeRole(ctx context.Context, userID int, role string) error
+}
+
+type PostgresRoleRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresRoleRepository(db *sql.DB) *PostgresRoleRepository {
+	return &PostgresRoleRepository{db: db}
+}
+
+func (r *PostgresRoleRepository) GetUserRoles(ctx context.Context, userID int) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT role FROM user_roles WHERE user_id = $1 ORDER BY role", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []string{}
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
+
+func (r *PostgresRoleRepository) GrantRole(ctx context.Context, userID int, role string) error {
+	query := "INSERT INTO user_roles (user_id, role) VALUES ($1, $2) ON CONFLICT DO NOTHING"
+	_, err := r.db.ExecContext(ctx, query, userID, role)
+	if isForeignKeyViolation(err) {
+		return ErrNotFound
+	} else if err != nil {
+		return fmt.Errorf("could not grant role: %v", err)
+	}
+	return nil
+}
+
+func (r *PostgresRoleRepository) RevokeRole(ctx context.Context, userID int, role string) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM user_roles WHERE user_id = $1 AND role = $2", userID, role)
+	if err != nil {
+		return fmt.Errorf("could not revoke role: %v", err)
+	}
+	return nil
+}
+
+// isForeignKeyViolation reports whether err comes from a foreign key constraint
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// MemoryRoleRepository checks users exist in users, like the user_roles foreign key
+type MemoryRoleRepository struct {
+	mu    sync.RWMutex
+	users UserRepository
+	roles map[int]map[string]bool
+}
+
+func NewMemoryRoleRepository(users UserRepository) *MemoryRoleRepository {
+	return &MemoryRoleRepository{users: users, roles: map[int]map[string]bool{}}
+}
+
+func (r *MemoryRoleRepository) GetUserRoles(ctx context.Context, userID int) ([]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	roles := []string{}
+	for role := range r.roles[userID] {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	return roles, nil
+}
+
+func (r *MemoryRoleRepository) GrantRole(ctx context.Context, userID int, role string) error {
+	if _, err := r.users.GetUserByID(ctx, userID); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.roles[userID] == nil {
+		r.roles[userID] = map[string]bool{}
+	}
+	r.roles[userID][role] = true
+	return nil
+}
+
+func (r *MemoryRoleRepository) RevokeRole(ctx context.Context, userID int, role string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.roles[userID], role)
+	return nil
+}
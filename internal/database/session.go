@@ -0,0 +1,144 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Session is a login of a user on a device, it lasts as long as its refresh tokens
+type Session struct {
+	ID         string     `json:"id"`
+	UserID     int        `json:"-"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"-"`
+	// AMR are the authentication methods of the login, the tokens of the
+	// session never claim more
+	AMR []string `json:"amr"`
+}
+
+// Active reports whether the session is neither revoked nor expired at now
+func (s *Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// sessionTouchInterval limits the writes of last_seen_at for busy sessions
+const sessionTouchInterval = time.Minute
+
+type SessionRepository interface {
+	CreateSession(ctx context.Context, session *Session) error
+	GetSession(ctx context.Context, id string) (*Session, error)
+	// ListUserSessions returns the active sessions of a user, the last seen first
+	ListUserSessions(ctx context.Context, userID int) ([]Session, error)
+	// TouchSession updates last_seen_at, at most once per minute, and expires_at
+	// when it is not zero
+	TouchSession(ctx context.Context, id string, expiresAt time.Time) error
+	RevokeSession(ctx context.Context, id string) error
+	// RevokeUserSessions revokes the sessions of a user but exceptID and returns
+	// the revoked ids
+	RevokeUserSessions(ctx context.Context, userID int, exceptID string) ([]string, error)
+}
+
+type PostgresSessionRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresSessionRepository(db *sql.DB) *PostgresSessionRepository {
+	return &PostgresSessionRepository{db: db}
+}
+
+func (r *PostgresSessionRepository) CreateSession(ctx context.Context, session *Session) error {
+	query := `INSERT INTO sessions (id, user_id, user_agent, ip, expires_at, amr)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        RETURNING created_at, last_seen_at`
+	err := r.db.QueryRowContext(ctx, query, session.ID, session.UserID, session.UserAgent, session.IP, session.ExpiresAt, pq.Array(session.AMR)).
+		Scan(&session.CreatedAt, &session.LastSeenAt)
+	if err != nil {
+		return fmt.Errorf("could not create session: %v", err)
+	}
+	return nil
+}
+
+func (r *PostgresSessionRepository) GetSession(ctx context.Context, id string) (*Session, error) {
+	var session Session
+	query := `SELECT id, user_id, user_agent, ip, created_at, last_seen_at, expires_at, revoked_at, amr
+        FROM sessions WHERE id = $1`
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IP,
+		&session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt, &session.RevokedAt, pq.Array(&session.AMR))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *PostgresSessionRepository) ListUserSessions(ctx context.Context, userID int) ([]Session, error) {
+	query := `SELECT id, user_id, user_agent, ip, created_at, last_seen_at, expires_at, revoked_at, amr
+        FROM sessions
+        WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+        ORDER BY last_seen_at DESC`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var session Session
+		err := rows.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IP,
+			&session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt, &session.RevokedAt, pq.Array(&session.AMR))
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+func (r *PostgresSessionRepository) TouchSession(ctx context.Context, id string, expiresAt time.Time) error {
+	if !expiresAt.IsZero() {
+		query := "UPDATE sessions SET last_seen_at = NOW(), expires_at = $2 WHERE id = $1"
+		_, err := r.db.ExecContext(ctx, query, id, expiresAt)
+		return err
+	}
+
+	query := "UPDATE sessions SET last_seen_at = NOW() WHERE id = $1 AND last_seen_at < $2"
+	_, err := r.db.ExecContext(ctx, query, id, time.Now().Add(-sessionTouchInterval))
+	return err
+}
+
+func (r *PostgresSessionRepository) RevokeSession(ctx context.Context, id string) error {
+	query := "UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL"
+	_, err := r.db.ExecContext(ctx, query, id)
+	return err
+}
+
+func (r *PostgresSessionRepository) RevokeUserSessions(ctx context.Context, userID int, exceptID string) ([]string, error) {
+	query := `UPDATE sessions SET revoked_at = NOW()
+        WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL
+        RETURNING id`
+	rows, err := r.db.QueryContext(ctx, query, userID, exceptID)
+	if err != nil {
+		return nil, fmt.Errorf("could not revoke sessions: %v", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,104 @@
+package database
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+type MemorySessionRepository struct {
+	mu       sync.Mutex
+	sessions map[string]Session
+}
+
+func NewMemorySessionRepository() *MemorySessionRepository {
+	return &MemorySessionRepository{sessions: map[string]Session{}}
+}
+
+func (r *MemorySessionRepository) CreateSession(ctx context.Context, session *Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	session.CreatedAt = now
+	session.LastSeenAt = now
+	r.sessions[session.ID] = *session
+	return nil
+}
+
+func (r *MemorySessionRepository) GetSession(ctx context.Context, id string) (*Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session, ok := r.sessions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &session, nil
+}
+
+func (r *MemorySessionRepository) ListUserSessions(ctx context.Context, userID int) ([]Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	sessions := []Session{}
+	for _, session := range r.sessions {
+		if session.UserID == userID && session.Active(now) {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+	return sessions, nil
+}
+
+func (r *MemorySessionRepository) TouchSession(ctx context.Context, id string, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session, ok := r.sessions[id]
+	if !ok {
+		return nil
+	}
+	now := time.Now()
+	if !expiresAt.IsZero() {
+		session.ExpiresAt = expiresAt
+		session.LastSeenAt = now
+	} else if session.LastSeenAt.Before(now.Add(-sessionTouchInterval)) {
+		session.LastSeenAt = now
+	}
+	r.sessions[id] = session
+	return nil
+}
+
+func (r *MemorySessionRepository) RevokeSession(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session, ok := r.sessions[id]
+	if ok && session.RevokedAt == nil {
+		now := time.Now()
+		session.RevokedAt = &now
+		r.sessions[id] = session
+	}
+	return nil
+}
+
+func (r *MemorySessionRepository) RevokeUserSessions(ctx context.Context, userID int, exceptID string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	var ids []string
+	for id, session := range r.sessions {
+		if session.UserID == userID && id != exceptID && session.RevokedAt == nil {
+			session.RevokedAt = &now
+			r.sessions[id] = session
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
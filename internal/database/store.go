@@ -0,0 +1,62 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+)
+
+var (
+	ErrNotFound    = errors.New("not found")
+	ErrEmailExists = errors.New("this email already exists")
+)
+
+// Store groups the repositories used by the handlers
+type Store struct {
+	Products      ProductRepository
+	Users         UserRepository
+	RefreshTokens RefreshTokenRepository
+	RevokedTokens RevokedTokenRepository
+	Roles         RoleRepository
+	UserTokens    UserTokenRepository
+	TwoFactor     TwoFactorRepository
+	LoginAttempts LoginAttemptRepository
+	APIKeys       APIKeyRepository
+	Sessions      SessionRepository
+	Identities    IdentityRepository
+}
+
+// NewPostgresStore returns repositories backed by the postgres database
+func NewPostgresStore(db *sql.DB) *Store {
+	return &Store{
+		Products:      NewPostgresProductRepository(db),
+		Users:         NewPostgresUserRepository(db),
+		RefreshTokens: NewPostgresRefreshTokenRepository(db),
+		RevokedTokens: NewPostgresRevokedTokenRepository(db),
+		Roles:         NewPostgresRoleRepository(db),
+		UserTokens:    NewPostgresUserTokenRepository(db),
+		TwoFactor:     NewPostgresTwoFactorRepository(db),
+		LoginAttempts: NewPostgresLoginAttemptRepository(db),
+		APIKeys:       NewPostgresAPIKeyRepository(db),
+		Sessions:      NewPostgresSessionRepository(db),
+		Identities:    NewPostgresIdentityRepository(db),
+	}
+}
+
+// NewMemoryStore returns repositories kept in memory, used to run the server
+// and its tests without a database
+func NewMemoryStore() *Store {
+	users := NewMemoryUserRepository()
+	return &Store{
+		Products:      NewMemoryProductRepository(),
+		Users:         users,
+		RefreshTokens: NewMemoryRefreshTokenRepository(),
+		RevokedTokens: NewMemoryRevokedTokenRepository(),
+		Roles:         NewMemoryRoleRepository(users),
+		UserTokens:    NewMemoryUserTokenRepository(),
+		TwoFactor:     NewMemoryTwoFactorRepository(users),
+		LoginAttempts: NewMemoryLoginAttemptRepository(),
+		APIKeys:       NewMemoryAPIKeyRepository(users),
+		Sessions:      NewMemorySessionRepository(),
+		Identities:    NewMemoryIdentityRepository(users),
+	}
+}
@@ -0,0 +1,125 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// RefreshToken is stored hashed, tokens rotated from the same login share a family
+type RefreshToken struct {
+	ID        int64
+	UserID    int
+	FamilyID  string
+	TokenHash string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+}
+
+type RefreshTokenRepository interface {
+	CreateRefreshToken(ctx context.Context, token *RefreshToken) error
+	GetRefreshTokenByHash(ctx context.Context, tokenHash string) (RefreshToken, error)
+	// MarkRefreshTokenUsed returns false when the token was already used or revoked
+	MarkRefreshTokenUsed(ctx context.Context, id int64) (bool, error)
+	RevokeRefreshTokenFamily(ctx context.Context, familyID string) error
+	// RevokeUserRefreshTokens ends every session of a user
+	RevokeUserRefreshTokens(ctx context.Context, userID int) error
+}
+
+// RevokedTokenRepository is the denylist of access tokens, by jti
+type RevokedTokenRepository interface {
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+type PostgresRefreshTokenRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresRefreshTokenRepository(db *sql.DB) *PostgresRefreshTokenRepository {
+	return &PostgresRefreshTokenRepository{db: db}
+}
+
+func (r *PostgresRefreshTokenRepository) CreateRefreshToken(ctx context.Context, token *RefreshToken) error {
+	query := `INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at)
+        VALUES ($1, $2, $3, $4)
+        RETURNING id, created_at`
+	err := r.db.QueryRowContext(ctx, query, token.UserID, token.FamilyID, token.TokenHash, token.ExpiresAt).
+		Scan(&token.ID, &token.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("could not create refresh token: %v", err)
+	}
+	return nil
+}
+
+func (r *PostgresRefreshTokenRepository) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	var token RefreshToken
+	query := `SELECT id, user_id, family_id, token_hash, expires_at, created_at, used_at, revoked_at
+        FROM refresh_tokens WHERE token_hash = $1`
+	err := r.db.QueryRowContext(ctx, query, tokenHash).
+		Scan(&token.ID, &token.UserID, &token.FamilyID, &token.TokenHash, &token.ExpiresAt, &token.CreatedAt, &token.UsedAt, &token.RevokedAt)
+	if err == sql.ErrNoRows {
+		return RefreshToken{}, ErrNotFound
+	} else if err != nil {
+		return RefreshToken{}, err
+	}
+	return token, nil
+}
+
+func (r *PostgresRefreshTokenRepository) MarkRefreshTokenUsed(ctx context.Context, id int64) (bool, error) {
+	// The conditions make the update atomic, only one concurrent refresh can win
+	query := `UPDATE refresh_tokens SET used_at = NOW()
+        WHERE id = $1 AND used_at IS NULL AND revoked_at IS NULL`
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+func (r *PostgresRefreshTokenRepository) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	query := "UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL"
+	_, err := r.db.ExecContext(ctx, query, familyID)
+	return err
+}
+
+func (r *PostgresRefreshTokenRepository) RevokeUserRefreshTokens(ctx context.Context, userID int) error {
+	query := "UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL"
+	_, err := r.db.ExecContext(ctx, query, userID)
+	return err
+}
+
+type PostgresRevokedTokenRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresRevokedTokenRepository(db *sql.DB) *PostgresRevokedTokenRepository {
+	return &PostgresRevokedTokenRepository{db: db}
+}
+
+func (r *PostgresRevokedTokenRepository) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	// Expired entries are useless, the token signature check already rejects them
+	if _, err := r.db.ExecContext(ctx, "DELETE FROM revoked_tokens WHERE expires_at < NOW()"); err != nil {
+		return err
+	}
+
+	query := "INSERT INTO revoked_tokens (jti, expires_at) VALUES ($1, $2) ON CONFLICT (jti) DO NOTHING"
+	_, err := r.db.ExecContext(ctx, query, jti, expiresAt)
+	return err
+}
+
+func (r *PostgresRevokedTokenRepository) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	var revoked bool
+	query := "SELECT EXISTS(SELECT 1 FROM revoked_tokens WHERE jti = $1)"
+	if err := r.db.QueryRowContext(ctx, query, jti).Scan(&revoked); err != nil {
+		return false, err
+	}
+	return revoked, nil
+}
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type MemoryRefreshTokenRepository struct {
+	mu     sync.Mutex
+	nextID int64
+	tokens map[int64]RefreshToken
+}
+
+func NewMemoryRefreshTokenRepository() *MemoryRefreshTokenRepository {
+	return &MemoryRefreshTokenRepository{nextID: 1, tokens: map[int64]RefreshToken{}}
+}
+
+func (r *MemoryRefreshTokenRepository) CreateRefreshToken(ctx context.Context, token *RefreshToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token.ID = r.nextID
+	token.CreatedAt = time.Now()
+	r.tokens[token.ID] = *token
+	r.nextID++
+	return nil
+}
+
+func (r *MemoryRefreshTokenRepository) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, token := range r.tokens {
+		if token.TokenHash == tokenHash {
+			return token, nil
+		}
+	}
+	return RefreshToken{}, ErrNotFound
+}
+
+func (r *MemoryRefreshTokenRepository) MarkRefreshTokenUsed(ctx context.Context, id int64) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, ok := r.tokens[id]
+	if !ok || token.UsedAt != nil || token.RevokedAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	token.UsedAt = &now
+	r.tokens[id] = token
+	return true, nil
+}
+
+func (r *MemoryRefreshTokenRepository) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for id, token := range r.tokens {
+		if token.FamilyID == familyID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+			r.tokens[id] = token
+		}
+	}
+	return nil
+}
+
+func (r *MemoryRefreshTokenRepository) RevokeUserRefreshTokens(ctx context.Context, userID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for id, token := range r.tokens {
+		if token.UserID == userID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+			r.tokens[id] = token
+		}
+	}
+	return nil
+}
+
+type MemoryRevokedTokenRepository struct {
+	mu     sync.Mutex
+	tokens map[string]time.Time
+}
+
+func NewMemoryRevokedTokenRepository() *MemoryRevokedTokenRepository {
+	return &MemoryRevokedTokenRepository{tokens: map[string]time.Time{}}
+}
+
+func (r *MemoryRevokedTokenRepository) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for id, expiry := range r.tokens {
+		if expiry.Before(now) {
+			delete(r.tokens, id)
+		}
+	}
+	r.tokens[jti] = expiresAt
+	return nil
+}
+
+func (r *MemoryRevokedTokenRepository) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, revoked := r.tokens[jti]
+	return revoked, nil
+}
@@ -0,0 +1,149 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// TOTP is the authenticator app secret of a user, 2FA is enabled once confirmed
+type TOTP struct {
+	UserID       int
+	Secret       string
+	ConfirmedAt  *time.Time
+	LastUsedStep int64
+	CreatedAt    time.Time
+}
+
+// Enabled reports whether the secret was confirmed
+func (t *TOTP) Enabled() bool {
+	return t.ConfirmedAt != nil
+}
+
+// TwoFactorRepository stores the TOTP secrets and the hashed recovery codes
+type TwoFactorRepository interface {
+	// SaveTOTP replaces the secret of a user, the new one is not confirmed
+	SaveTOTP(ctx context.Context, userID int, secret string) error
+	GetTOTP(ctx context.Context, userID int) (*TOTP, error)
+	ConfirmTOTP(ctx context.Context, userID int) error
+	// UseTOTPStep records the step of an accepted code, it returns false when
+	// the step or a later one was already used
+	UseTOTPStep(ctx context.Context, userID int, step int64) (bool, error)
+	// DeleteTOTP disables 2FA and deletes the recovery codes
+	DeleteTOTP(ctx context.Context, userID int) error
+	ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error
+	// UseRecoveryCode returns false when the code does not exist or was used
+	UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error)
+}
+
+type PostgresTwoFactorRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresTwoFactorRepository(db *sql.DB) *PostgresTwoFactorRepository {
+	return &PostgresTwoFactorRepository{db: db}
+}
+
+func (r *PostgresTwoFactorRepository) SaveTOTP(ctx context.Context, userID int, secret string) error {
+	query := `INSERT INTO user_totp (user_id, secret) VALUES ($1, $2)
+        ON CONFLICT (user_id) DO UPDATE
+        SET secret = EXCLUDED.secret, confirmed_at = NULL, last_used_step = 0, created_at = NOW()`
+	_, err := r.db.ExecContext(ctx, query, userID, secret)
+	if isForeignKeyViolation(err) {
+		return ErrNotFound
+	} else if err != nil {
+		return fmt.Errorf("could not save totp secret: %v", err)
+	}
+	return nil
+}
+
+func (r *PostgresTwoFactorRepository) GetTOTP(ctx context.Context, userID int) (*TOTP, error) {
+	var totp TOTP
+	query := "SELECT user_id, secret, confirmed_at, last_used_step, created_at FROM user_totp WHERE user_id = $1"
+	err := r.db.QueryRowContext(ctx, query, userID).
+		Scan(&totp.UserID, &totp.Secret, &totp.ConfirmedAt, &totp.LastUsedStep, &totp.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &totp, nil
+}
+
+func (r *PostgresTwoFactorRepository) ConfirmTOTP(ctx context.Context, userID int) error {
+	query := "UPDATE user_totp SET confirmed_at = COALESCE(confirmed_at, NOW()) WHERE user_id = $1"
+	result, err := r.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("could not confirm totp: %v", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *PostgresTwoFactorRepository) UseTOTPStep(ctx context.Context, userID int, step int64) (bool, error) {
+	// The condition makes the update atomic, a code can only be used once
+	query := "UPDATE user_totp SET last_used_step = $1 WHERE user_id = $2 AND last_used_step < $1"
+	result, err := r.db.ExecContext(ctx, query, step, userID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+func (r *PostgresTwoFactorRepository) DeleteTOTP(ctx context.Context, userID int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_totp WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *PostgresTwoFactorRepository) ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	for _, hash := range codeHashes {
+		query := "INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)"
+		if _, err := tx.ExecContext(ctx, query, userID, hash); err != nil {
+			return fmt.Errorf("could not save recovery codes: %v", err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *PostgresTwoFactorRepository) UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error) {
+	query := `UPDATE user_recovery_codes SET used_at = NOW()
+        WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+	result, err := r.db.ExecContext(ctx, query, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
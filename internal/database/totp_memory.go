@@ -0,0 +1,107 @@
+package database
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryTwoFactorRepository checks users exist in users, like the foreign keys
+type MemoryTwoFactorRepository struct {
+	mu            sync.Mutex
+	users         UserRepository
+	totp          map[int]TOTP
+	recoveryCodes map[int]map[string]bool
+}
+
+func NewMemoryTwoFactorRepository(users UserRepository) *MemoryTwoFactorRepository {
+	return &MemoryTwoFactorRepository{
+		users:         users,
+		totp:          map[int]TOTP{},
+		recoveryCodes: map[int]map[string]bool{},
+	}
+}
+
+func (r *MemoryTwoFactorRepository) SaveTOTP(ctx context.Context, userID int, secret string) error {
+	if _, err := r.users.GetUserByID(ctx, userID); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.totp[userID] = TOTP{UserID: userID, Secret: secret, CreatedAt: time.Now()}
+	return nil
+}
+
+func (r *MemoryTwoFactorRepository) GetTOTP(ctx context.Context, userID int) (*TOTP, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	totp, ok := r.totp[userID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &totp, nil
+}
+
+func (r *MemoryTwoFactorRepository) ConfirmTOTP(ctx context.Context, userID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	totp, ok := r.totp[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	if totp.ConfirmedAt == nil {
+		now := time.Now()
+		totp.ConfirmedAt = &now
+		r.totp[userID] = totp
+	}
+	return nil
+}
+
+func (r *MemoryTwoFactorRepository) UseTOTPStep(ctx context.Context, userID int, step int64) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	totp, ok := r.totp[userID]
+	if !ok || totp.LastUsedStep >= step {
+		return false, nil
+	}
+	totp.LastUsedStep = step
+	r.totp[userID] = totp
+	return true, nil
+}
+
+func (r *MemoryTwoFactorRepository) DeleteTOTP(ctx context.Context, userID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.totp, userID)
+	delete(r.recoveryCodes, userID)
+	return nil
+}
+
+func (r *MemoryTwoFactorRepository) ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	codes := map[string]bool{}
+	for _, hash := range codeHashes {
+		codes[hash] = true
+	}
+	r.recoveryCodes[userID] = codes
+	return nil
+}
+
+func (r *MemoryTwoFactorRepository) UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.recoveryCodes[userID][codeHash] {
+		return false, nil
+	}
+	delete(r.recoveryCodes[userID], codeHash)
+	return true, nil
+}
@@ -1,11 +1,14 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 type User struct {
@@ -15,6 +18,13 @@ type User struct {
 	Password  string    `json:"password"`
 	CreatedAt time.Time `json:"-"` // created_at
 	UpdatedAt time.Time `json:"-"` // updated_at
+	// EmailVerifiedAt is nil until the user follows the verification link
+	EmailVerifiedAt *time.Time `json:"-"` // email_verified_at
+}
+
+// EmailVerified reports whether the user verified its email address
+func (u *User) EmailVerified() bool {
+	return u.EmailVerifiedAt != nil
 }
 
 type UserResponse struct {
@@ -23,51 +33,55 @@ type UserResponse struct {
 	Name  string `json:"name"`
 }
 
+// NormalizeEmail returns the form emails are stored and looked up in, so the
+// case of an address never tells two accounts apart
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// UserRepository stores the user accounts, the emails are normalized with
+// NormalizeEmail
+type UserRepository interface {
+	CheckIfEmailExists(ctx context.Context, user User) (bool, error)
+	// CreateNewUser returns ErrEmailExists when the email is already used
+	CreateNewUser(ctx context.Context, user *User) (*User, error)
+	FetchPasswordHash(ctx context.Context, user User) (string, error)
+	GetUserByID(ctx context.Context, id int) (*User, error)
+	GetUserByEmail(ctx context.Context, email string) (*User, error)
+	// UpdateUser only updates the non empty fields of user, a new email is no
+	// longer verified. It returns ErrEmailExists when the email is already used.
+	UpdateUser(ctx context.Context, user *User) (*User, error)
+	DeleteUser(ctx context.Context, id int) error
+	UpdatePassword(ctx context.Context, userID int, passwordHash string) error
+	// MarkEmailVerified sets the email verification time, once
+	MarkEmailVerified(ctx context.Context, userID int) error
+}
+
+type PostgresUserRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresUserRepository(db *sql.DB) *PostgresUserRepository {
+	return &PostgresUserRepository{db: db}
+}
+
 // Check if email field already exist in the database
-func CheckIfEmailExists(user User) (bool, error) {
+func (r *PostgresUserRepository) CheckIfEmailExists(ctx context.Context, user User) (bool, error) {
 	var err error
 	var exists bool
-	// var user models.User
 
 	query := "SELECT EXISTS(SELECT 1 FROM users WHERE email=$1)"
-	err = DB.QueryRow(query, user.Email).Scan(&exists)
+	err = r.db.QueryRowContext(ctx, query, NormalizeEmail(user.Email)).Scan(&exists)
 	if err != nil {
 		return false, err
 	}
 	return exists, nil
 }
 
-// Insert User to the database
-func InsertUser(user User) (User, error) {
-	var err error
-	query := "INSERT INTO users (email, name, password) VALUES ($1, $2, $3)"
-	_, err = DB.Exec(query, user.Email, user.Name, user.Password)
-	if err != nil {
-		return User{}, fmt.Errorf("could not create user")
-	}
-	return user, nil
-}
-
-// Insert User to the database
-func CreateUser(user *User) (*User, error) {
-	var err error
-	query := "INSERT INTO users (email, name, password) VALUES ($1, $2, $3)"
-	_, err = DB.Exec(query, user.Email, user.Name, user.Password)
-	if err != nil {
-		return &User{}, fmt.Errorf("could not create user")
-	}
-
-	newUserResponse := &User{
-		Email: user.Email,
-		Name:  user.Name,
-	}
-	return newUserResponse, nil
-}
-
 // Fetch password hash from the database
-func FetchPasswordHash(user User) (string, error) {
+func (r *PostgresUserRepository) FetchPasswordHash(ctx context.Context, user User) (string, error) {
 	var storedHashedPassword string
-	err := DB.QueryRow("SELECT password FROM users where email=$1", user.Email).
+	err := r.db.QueryRowContext(ctx, "SELECT password FROM users where email=$1", NormalizeEmail(user.Email)).
 		Scan(&storedHashedPassword)
 	if err == sql.ErrNoRows {
 		return "", fmt.Errorf("invalid email or password")
@@ -77,11 +91,37 @@ func FetchPasswordHash(user User) (string, error) {
 	return storedHashedPassword, nil
 }
 
-func CreateNewUser(user *User) (*User, error) {
+// GetUserByID returns the user with its password hash
+func (r *PostgresUserRepository) GetUserByID(ctx context.Context, id int) (*User, error) {
+	return r.getUser(ctx, "id = $1", id)
+}
+
+// GetUserByEmail returns the user with its password hash
+func (r *PostgresUserRepository) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	return r.getUser(ctx, "email = $1", NormalizeEmail(email))
+}
+
+func (r *PostgresUserRepository) getUser(ctx context.Context, where string, arg any) (*User, error) {
+	var user User
+	query := "SELECT id, email, name, password, created_at, updated_at, email_verified_at FROM users WHERE " + where
+	err := r.db.QueryRowContext(ctx, query, arg).
+		Scan(&user.ID, &user.Email, &user.Name, &user.Password, &user.CreatedAt, &user.UpdatedAt, &user.EmailVerifiedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *PostgresUserRepository) CreateNewUser(ctx context.Context, user *User) (*User, error) {
 	var err error
+	user.Email = NormalizeEmail(user.Email)
 	query := "INSERT INTO users (email, name, password) VALUES ($1, $2, $3) RETURNING id"
-	err = DB.QueryRow(query, user.Email, user.Name, user.Password).Scan(&user.ID)
-	if err != nil {
+	err = r.db.QueryRowContext(ctx, query, user.Email, user.Name, user.Password).Scan(&user.ID)
+	if isUniqueViolation(err) {
+		return &User{}, ErrEmailExists
+	} else if err != nil {
 		return &User{}, fmt.Errorf("could not create user")
 	}
 
@@ -93,32 +133,76 @@ func CreateNewUser(user *User) (*User, error) {
 	return newUserResponse, nil
 }
 
-func UpdateUser(user *User) (*User, error) {
-	var err error
+func (r *PostgresUserRepository) UpdateUser(ctx context.Context, user *User) (*User, error) {
+	// A new email has to be verified again
 	updateQuery := `UPDATE users
-        SET email = COALESCE($1, email),
-            name = COALESCE($2, name),
-            password = COALESCE($3, password),
+        SET email = COALESCE(NULLIF($1, ''), email),
+            name = COALESCE(NULLIF($2, ''), name),
+            password = COALESCE(NULLIF($3, ''), password),
+            email_verified_at = CASE WHEN NULLIF($1, '') IS NULL OR $1 = email THEN email_verified_at END,
             updated_at = NOW()
-        WHERE id = $4;`
+        WHERE id = $4
+        RETURNING id, email, name, created_at, updated_at, email_verified_at`
 
-	_, err = DB.Exec(updateQuery, user.Email, user.Name, user.ID)
-	if err != nil {
+	var updatedUser User
+	err := r.db.QueryRowContext(ctx, updateQuery, NormalizeEmail(user.Email), user.Name, user.Password, user.ID).
+		Scan(&updatedUser.ID, &updatedUser.Email, &updatedUser.Name, &updatedUser.CreatedAt, &updatedUser.UpdatedAt, &updatedUser.EmailVerifiedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if isUniqueViolation(err) {
+		return nil, ErrEmailExists
+	} else if err != nil {
 		return nil, fmt.Errorf("Error Updating fields: %v", err)
 	}
 
-	// Fetch the updated account result
-	var updatedUser User
-	fetchQuery := "SELECT id, email, name, updated_at FROM users WHERE id = $1;"
+	// Return Updated User
+	return &updatedUser, nil
+}
 
-	// Execute the select query
-	err = DB.QueryRow(fetchQuery, user.ID).
-		Scan(&updatedUser.ID, &updatedUser.Email, &updatedUser.Name, &updatedUser.UpdatedAt)
+func (r *PostgresUserRepository) DeleteUser(ctx context.Context, id int) error {
+	// The tokens, roles and 2FA secrets of the user are deleted by cascade
+	result, err := r.db.ExecContext(ctx, "DELETE FROM users WHERE id = $1", id)
 	if err != nil {
-		return nil, fmt.Errorf("error fetching user details: %v", err)
+		return fmt.Errorf("could not delete user: %v", err)
 	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
 
-	// Return Updated User
-	return &updatedUser, nil
+func (r *PostgresUserRepository) UpdatePassword(ctx context.Context, userID int, passwordHash string) error {
+	query := "UPDATE users SET password = $1, updated_at = NOW() WHERE id = $2"
+	result, err := r.db.ExecContext(ctx, query, passwordHash, userID)
+	if err != nil {
+		return fmt.Errorf("could not update password: %v", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
 }
 
+func (r *PostgresUserRepository) MarkEmailVerified(ctx context.Context, userID int) error {
+	query := "UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()) WHERE id = $1"
+	result, err := r.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("could not verify email: %v", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// isUniqueViolation reports whether err comes from a unique constraint
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
@@ -0,0 +1,170 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MemoryUserRepository keeps the users in memory with the same unique email
+// constraint as the users table
+type MemoryUserRepository struct {
+	mu      sync.RWMutex
+	nextID  int
+	users   map[int]User
+	byEmail map[string]int
+}
+
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{nextID: 1, users: map[int]User{}, byEmail: map[string]int{}}
+}
+
+func (r *MemoryUserRepository) CheckIfEmailExists(ctx context.Context, user User) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, exists := r.byEmail[NormalizeEmail(user.Email)]
+	return exists, nil
+}
+
+func (r *MemoryUserRepository) CreateNewUser(ctx context.Context, user *User) (*User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user.Email = NormalizeEmail(user.Email)
+	if _, exists := r.byEmail[user.Email]; exists {
+		return &User{}, ErrEmailExists
+	}
+
+	now := time.Now()
+	stored := User{
+		ID:        r.nextID,
+		Email:     user.Email,
+		Name:      user.Name,
+		Password:  user.Password,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	r.users[stored.ID] = stored
+	r.byEmail[stored.Email] = stored.ID
+	r.nextID++
+
+	user.ID = stored.ID
+	return &User{ID: stored.ID, Email: stored.Email, Name: stored.Name}, nil
+}
+
+func (r *MemoryUserRepository) FetchPasswordHash(ctx context.Context, user User) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	id, ok := r.byEmail[NormalizeEmail(user.Email)]
+	if !ok {
+		return "", fmt.Errorf("invalid email or password")
+	}
+	return r.users[id].Password, nil
+}
+
+func (r *MemoryUserRepository) GetUserByID(ctx context.Context, id int) (*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &user, nil
+}
+
+func (r *MemoryUserRepository) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	id, ok := r.byEmail[NormalizeEmail(email)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	user := r.users[id]
+	return &user, nil
+}
+
+func (r *MemoryUserRepository) UpdateUser(ctx context.Context, user *User) (*User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.users[user.ID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	email := NormalizeEmail(user.Email)
+	if email != "" && email != stored.Email {
+		if _, exists := r.byEmail[email]; exists {
+			return nil, ErrEmailExists
+		}
+		delete(r.byEmail, stored.Email)
+		stored.Email = email
+		stored.EmailVerifiedAt = nil
+		r.byEmail[stored.Email] = stored.ID
+	}
+	if user.Name != "" {
+		stored.Name = user.Name
+	}
+	if user.Password != "" {
+		stored.Password = user.Password
+	}
+	stored.UpdatedAt = time.Now()
+	r.users[stored.ID] = stored
+
+	return &User{
+		ID:              stored.ID,
+		Email:           stored.Email,
+		Name:            stored.Name,
+		CreatedAt:       stored.CreatedAt,
+		UpdatedAt:       stored.UpdatedAt,
+		EmailVerifiedAt: stored.EmailVerifiedAt,
+	}, nil
+}
+
+func (r *MemoryUserRepository) DeleteUser(ctx context.Context, id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(r.users, id)
+	delete(r.byEmail, stored.Email)
+	return nil
+}
+
+func (r *MemoryUserRepository) UpdatePassword(ctx context.Context, userID int, passwordHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	stored.Password = passwordHash
+	stored.UpdatedAt = time.Now()
+	r.users[userID] = stored
+	return nil
+}
+
+func (r *MemoryUserRepository) MarkEmailVerified(ctx context.Context, userID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	if stored.EmailVerifiedAt == nil {
+		now := time.Now()
+		stored.EmailVerifiedAt = &now
+		r.users[userID] = stored
+	}
+	return nil
+}
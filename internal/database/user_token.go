@@ -0,0 +1,115 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Purposes of the user tokens
+const (
+	TokenPurposePasswordReset     string = "password_reset"
+	TokenPurposeEmailVerification string = "email_verification"
+	TokenPurposeLoginChallenge    string = "login_challenge"
+	TokenPurposeMagicLink         string = "magic_link"
+)
+
+// UserToken is a single-use token sent to a user, stored hashed
+type UserToken struct {
+	ID        int64
+	UserID    int
+	Purpose   string
+	TokenHash string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	UsedAt    *time.Time
+	// LoginMethod is the first factor of the login a challenge continues
+	LoginMethod string
+}
+
+type UserTokenRepository interface {
+	CreateUserToken(ctx context.Context, token *UserToken) error
+	// ConsumeUserToken marks an unused, unexpired token as used and returns it,
+	// or returns ErrNotFound
+	ConsumeUserToken(ctx context.Context, purpose, tokenHash string) (*UserToken, error)
+	// DeleteUserTokens deletes the tokens of a user for purpose
+	DeleteUserTokens(ctx context.Context, userID int, purpose string) error
+	// GetUserToken returns an unused, unexpired token without consuming it, or
+	// ErrNotFound
+	GetUserToken(ctx context.Context, purpose, tokenHash string) (*UserToken, error)
+	// GetLatestUserToken returns the last token created for a user and purpose,
+	// used or not, or ErrNotFound
+	GetLatestUserToken(ctx context.Context, userID int, purpose string) (*UserToken, error)
+}
+
+type PostgresUserTokenRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresUserTokenRepository(db *sql.DB) *PostgresUserTokenRepository {
+	return &PostgresUserTokenRepository{db: db}
+}
+
+func (r *PostgresUserTokenRepository) CreateUserToken(ctx context.Context, token *UserToken) error {
+	query := `INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at, login_method)
+        VALUES ($1, $2, $3, $4, $5)
+        RETURNING id, created_at`
+	err := r.db.QueryRowContext(ctx, query, token.UserID, token.Purpose, token.TokenHash, token.ExpiresAt, token.LoginMethod).
+		Scan(&token.ID, &token.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("could not create token: %v", err)
+	}
+	return nil
+}
+
+func (r *PostgresUserTokenRepository) ConsumeUserToken(ctx context.Context, purpose, tokenHash string) (*UserToken, error) {
+	var token UserToken
+	// Only one concurrent request can consume the token
+	query := `UPDATE user_tokens SET used_at = NOW()
+        WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+        RETURNING id, user_id, purpose, token_hash, expires_at, created_at, used_at, login_method`
+	err := r.db.QueryRowContext(ctx, query, tokenHash, purpose).
+		Scan(&token.ID, &token.UserID, &token.Purpose, &token.TokenHash, &token.ExpiresAt, &token.CreatedAt, &token.UsedAt, &token.LoginMethod)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *PostgresUserTokenRepository) DeleteUserTokens(ctx context.Context, userID int, purpose string) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM user_tokens WHERE user_id = $1 AND purpose = $2", userID, purpose)
+	return err
+}
+
+func (r *PostgresUserTokenRepository) GetLatestUserToken(ctx context.Context, userID int, purpose string) (*UserToken, error) {
+	var token UserToken
+	query := `SELECT id, user_id, purpose, token_hash, expires_at, created_at, used_at, login_method
+        FROM user_tokens WHERE user_id = $1 AND purpose = $2
+        ORDER BY created_at DESC, id DESC LIMIT 1`
+	err := r.db.QueryRowContext(ctx, query, userID, purpose).
+		Scan(&token.ID, &token.UserID, &token.Purpose, &token.TokenHash, &token.ExpiresAt, &token.CreatedAt, &token.UsedAt, &token.LoginMethod)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *PostgresUserTokenRepository) GetUserToken(ctx context.Context, purpose, tokenHash string) (*UserToken, error) {
+	var token UserToken
+	query := `SELECT id, user_id, purpose, token_hash, expires_at, created_at, used_at, login_method
+        FROM user_tokens
+        WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()`
+	err := r.db.QueryRowContext(ctx, query, tokenHash, purpose).
+		Scan(&token.ID, &token.UserID, &token.Purpose, &token.TokenHash, &token.ExpiresAt, &token.CreatedAt, &token.UsedAt, &token.LoginMethod)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
@@ -0,0 +1,95 @@
+package database
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type MemoryUserTokenRepository struct {
+	mu     sync.Mutex
+	nextID int64
+	tokens map[int64]UserToken
+}
+
+func NewMemoryUserTokenRepository() *MemoryUserTokenRepository {
+	return &MemoryUserTokenRepository{nextID: 1, tokens: map[int64]UserToken{}}
+}
+
+func (r *MemoryUserTokenRepository) CreateUserToken(ctx context.Context, token *UserToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token.ID = r.nextID
+	token.CreatedAt = time.Now()
+	r.tokens[token.ID] = *token
+	r.nextID++
+	return nil
+}
+
+func (r *MemoryUserTokenRepository) ConsumeUserToken(ctx context.Context, purpose, tokenHash string) (*UserToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for id, token := range r.tokens {
+		if token.TokenHash != tokenHash || token.Purpose != purpose {
+			continue
+		}
+		if token.UsedAt != nil || !token.ExpiresAt.After(now) {
+			return nil, ErrNotFound
+		}
+		token.UsedAt = &now
+		r.tokens[id] = token
+		return &token, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryUserTokenRepository) DeleteUserTokens(ctx context.Context, userID int, purpose string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, token := range r.tokens {
+		if token.UserID == userID && token.Purpose == purpose {
+			delete(r.tokens, id)
+		}
+	}
+	return nil
+}
+
+func (r *MemoryUserTokenRepository) GetLatestUserToken(ctx context.Context, userID int, purpose string) (*UserToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var latest *UserToken
+	for _, token := range r.tokens {
+		if token.UserID != userID || token.Purpose != purpose {
+			continue
+		}
+		if latest == nil || token.ID > latest.ID {
+			found := token
+			latest = &found
+		}
+	}
+	if latest == nil {
+		return nil, ErrNotFound
+	}
+	return latest, nil
+}
+
+func (r *MemoryUserTokenRepository) GetUserToken(ctx context.Context, purpose, tokenHash string) (*UserToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, token := range r.tokens {
+		if token.TokenHash != tokenHash || token.Purpose != purpose {
+			continue
+		}
+		if token.UsedAt != nil || !token.ExpiresAt.After(time.Now()) {
+			return nil, ErrNotFound
+		}
+		return &token, nil
+	}
+	return nil, ErrNotFound
+}
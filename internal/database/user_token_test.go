@@ -0,0 +1,116 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// columnsDriver answers every query with one row of the columns the query
+// selects or returns, so Scan fails when the scan targets do not match them
+type columnsDriver struct{}
+
+func (columnsDriver) Open(string) (driver.Conn, error) { return columnsConn{}, nil }
+
+type columnsConn struct{}
+
+func (columnsConn) Prepare(query string) (driver.Stmt, error) { return columnsStmt(query), nil }
+func (columnsConn) Close() error                              { return nil }
+func (columnsConn) Begin() (driver.Tx, error)                 { return nil, driver.ErrSkip }
+
+type columnsStmt string
+
+var (
+	returningColumns = regexp.MustCompile(`(?s)RETURNING (.*)$`)
+	selectColumns    = regexp.MustCompile(`(?s)^\s*SELECT (.*?)\s+FROM`)
+)
+
+func (columnsStmt) Close() error  { return nil }
+func (columnsStmt) NumInput() int { return -1 }
+
+func (s columnsStmt) Exec([]driver.Value) (driver.Result, error) { return driver.RowsAffected(1), nil }
+
+func (s columnsStmt) Query([]driver.Value) (driver.Rows, error) {
+	match := returningColumns.FindStringSubmatch(string(s))
+	if match == nil {
+		match = selectColumns.FindStringSubmatch(string(s))
+	}
+	if match == nil {
+		return &columnsRows{}, nil
+	}
+	var columns []string
+	for _, column := range strings.Split(match[1], ",") {
+		columns = append(columns, strings.TrimSpace(column))
+	}
+	return &columnsRows{columns: columns}, nil
+}
+
+type columnsRows struct {
+	columns []string
+	done    bool
+}
+
+func (r *columnsRows) Columns() []string { return r.columns }
+func (r *columnsRows) Close() error      { return nil }
+
+func (r *columnsRows) Next(dest []driver.Value) error {
+	if r.done || r.columns == nil {
+		return io.EOF
+	}
+	r.done = true
+	for i, column := range r.columns {
+		switch {
+		case column == "id" || strings.HasSuffix(column, "_id"):
+			dest[i] = int64(1)
+		case strings.HasSuffix(column, "_at"):
+			dest[i] = time.Now()
+		default:
+			dest[i] = column
+		}
+	}
+	return nil
+}
+
+func init() {
+	sql.Register("columns", columnsDriver{})
+}
+
+func TestPostgresUserTokenColumns(t *testing.T) {
+	db, err := sql.Open("columns", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	repo := NewPostgresUserTokenRepository(db)
+	ctx := context.Background()
+
+	if err := repo.CreateUserToken(ctx, &UserToken{UserID: 1, Purpose: TokenPurposeLoginChallenge}); err != nil {
+		t.Errorf("CreateUserToken: %v", err)
+	}
+	reads := map[string]func() (*UserToken, error){
+		"ConsumeUserToken": func() (*UserToken, error) {
+			return repo.ConsumeUserToken(ctx, TokenPurposeLoginChallenge, "hash")
+		},
+		"GetUserToken": func() (*UserToken, error) {
+			return repo.GetUserToken(ctx, TokenPurposeLoginChallenge, "hash")
+		},
+		"GetLatestUserToken": func() (*UserToken, error) {
+			return repo.GetLatestUserToken(ctx, 1, TokenPurposeLoginChallenge)
+		},
+	}
+	for name, read := range reads {
+		token, err := read()
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if token.LoginMethod != "login_method" {
+			t.Errorf("%s: got login method %q, want the login_method column", name, token.LoginMethod)
+		}
+	}
+}
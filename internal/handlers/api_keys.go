@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/0xSumeet/go_api/internal/database"
+	"github.com/0xSumeet/go_api/internal/middleware"
+	"github.com/0xSumeet/go_api/internal/rbac"
+	"github.com/0xSumeet/go_api/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type apiKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// CreateAPIKey mints an API key acting for the authenticated user
+func (h *Handler) CreateAPIKey(c *gin.Context) {
+	userID, ok := auth.CurrentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, map[string]any{"error": "not authenticated"})
+		return
+	}
+	h.createAPIKey(c, &userID)
+}
+
+// CreateServiceAPIKey mints an API key owned by no user, for services like the
+// ERP sync
+func (h *Handler) CreateServiceAPIKey(c *gin.Context) {
+	h.createAPIKey(c, nil)
+}
+
+// createAPIKey returns the new key once, only its hash is stored
+func (h *Handler) createAPIKey(c *gin.Context, userID *int) {
+	claims, ok := auth.GetClaims(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, map[string]any{"error": "not authenticated"})
+		return
+	}
+
+	var request apiKeyRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
+	}
+
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": "name is required"})
+		return
+	}
+	if len(request.Scopes) == 0 {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": "at least one scope is required"})
+		return
+	}
+	// A key never gets more than the token minting it
+	for _, scope := range request.Scopes {
+		if !rbac.IsAPIKeyScope(scope) {
+			c.JSON(http.StatusBadRequest, map[string]any{"error": "invalid scope " + scope})
+			return
+		}
+		if !rbac.HasPermission(claims.Roles, scope) {
+			c.JSON(http.StatusForbidden, map[string]any{"error": "missing permission " + scope})
+			return
+		}
+	}
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": "expires_at must be in the future"})
+		return
+	}
+
+	plaintext, prefix, hash, err := utils.GenerateAPIKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "could not generate api key"})
+		return
+	}
+
+	key := &database.APIKey{
+		UserID:    userID,
+		Name:      request.Name,
+		Prefix:    prefix,
+		KeyHash:   hash,
+		Scopes:    request.Scopes,
+		ExpiresAt: request.ExpiresAt,
+	}
+	if err := h.APIKeys.CreateAPIKey(c.Request.Context(), key); err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, map[string]any{
+		"key":     plaintext,
+		"api_key": key,
+	})
+}
+
+// ListAPIKeys returns the API keys of the authenticated user
+func (h *Handler) ListAPIKeys(c *gin.Context) {
+	userID, ok := auth.CurrentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, map[string]any{"error": "not authenticated"})
+		return
+	}
+	h.listAPIKeys(c, &userID)
+}
+
+// ListServiceAPIKeys returns the API keys owned by no user
+func (h *Handler) ListServiceAPIKeys(c *gin.Context) {
+	h.listAPIKeys(c, nil)
+}
+
+func (h *Handler) listAPIKeys(c *gin.Context, userID *int) {
+	keys, err := h.APIKeys.ListAPIKeys(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+	c.JSON(http.StatusOK, map[string]any{"api_keys": keys})
+}
+
+// RevokeAPIKey revokes an API key of the authenticated user
+func (h *Handler) RevokeAPIKey(c *gin.Context) {
+	userID, ok := auth.CurrentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, map[string]any{"error": "not authenticated"})
+		return
+	}
+	h.revokeAPIKey(c, func(key *database.APIKey) bool {
+		return key.UserID != nil && *key.UserID == userID
+	})
+}
+
+// RevokeAnyAPIKey revokes a service key, or the key of any user
+func (h *Handler) RevokeAnyAPIKey(c *gin.Context) {
+	h.revokeAPIKey(c, func(*database.APIKey) bool { return true })
+}
+
+// revokeAPIKey revokes the key of the id param when allowed accepts it, other
+// keys are reported as not found
+func (h *Handler) revokeAPIKey(c *gin.Context, allowed func(*database.APIKey) bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": "Invalid api key id"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	key, err := h.APIKeys.GetAPIKey(ctx, id)
+	if errors.Is(err, database.ErrNotFound) || (err == nil && !allowed(key)) {
+		c.JSON(http.StatusNotFound, map[string]any{"error": "api key not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+
+	if err := h.APIKeys.RevokeAPIKey(ctx, id); err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]any{"message": "api key revoked"})
+}
@@ -0,0 +1,187 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0xSumeet/go_api/internal/database"
+	"github.com/0xSumeet/go_api/pkg/utils"
+)
+
+// createAPIKey creates a key with scopes at path and returns the key and its id
+func (s *testServer) createAPIKey(path, token string, scopes ...string) (string, int) {
+	s.t.Helper()
+	body := s.expect(s.do(http.MethodPost, path, token, map[string]any{
+		"name":   "erp-sync",
+		"scopes": scopes,
+	}), http.StatusCreated)
+	return body["key"].(string), int(body["api_key"].(map[string]any)["id"].(float64))
+}
+
+// withKey serves a request authenticated by an API key
+func (s *testServer) withKey(method, path, key string, body any) *httptest.ResponseRecorder {
+	s.t.Helper()
+	return s.do(method, path, "", body, "X-API-Key", key)
+}
+
+// canList reports whether an API key can read the product listing
+func (s *testServer) canList(key string) bool {
+	s.t.Helper()
+	return s.withKey(http.MethodGet, "/secure/products", key, nil).Code == http.StatusOK
+}
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("manager@example.com", "catalog_manager")
+	key, _ := s.createAPIKey("/secure/api-keys", s.token("manager@example.com"), "products:read")
+	if !s.canList(key) {
+		t.Fatal("the new key cannot read the products")
+	}
+
+	prefix, _ := utils.ParseAPIKeyPrefix(key)
+	tests := []struct {
+		name string
+		key  string
+	}{
+		{"not an api key", "secret"},
+		{"no secret", utils.APIKeyPrefix + prefix + "_"},
+		{"unknown prefix", utils.APIKeyPrefix + "000000000000_" + strings.Repeat("a", 43)},
+		// The prefix finds the key, the secret must still match its hash
+		{"wrong secret", utils.APIKeyPrefix + prefix + "_" + strings.Repeat("a", 43)},
+		{"truncated secret", key[:len(key)-1]},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body := s.expect(s.withKey(http.MethodGet, "/secure/products", test.key, nil), http.StatusUnauthorized)
+			if body["error"] != "Invalid API key" {
+				t.Errorf("got %v", body)
+			}
+		})
+	}
+
+	stored, err := s.h.APIKeys.GetAPIKeyByPrefix(context.Background(), prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.KeyHash == key || strings.Contains(stored.KeyHash, key) {
+		t.Error("the key is stored in clear")
+	}
+}
+
+func TestAPIKeyRevocationAndExpiry(t *testing.T) {
+	s := newTestServer(t)
+	userID := s.createUser("manager@example.com", "catalog_manager")
+	token := s.token("manager@example.com")
+	key, id := s.createAPIKey("/secure/api-keys", token, "products:read")
+
+	s.expect(s.do(http.MethodDelete, "/secure/api-keys/"+strconv.Itoa(id), token, nil), http.StatusOK)
+	body := s.expect(s.withKey(http.MethodGet, "/secure/products", key, nil), http.StatusUnauthorized)
+	if body["error"] != "API key has been revoked or has expired" {
+		t.Errorf("revoked key: got %v", body)
+	}
+
+	body = s.expect(s.do(http.MethodPost, "/secure/api-keys", token, map[string]any{
+		"name":       "past",
+		"scopes":     []string{"products:read"},
+		"expires_at": time.Now().Add(-time.Hour),
+	}), http.StatusBadRequest)
+	if body["error"] != "expires_at must be in the future" {
+		t.Errorf("creating an expired key: got %v", body)
+	}
+
+	// Keys expire while in use, store one that already has
+	expired, prefix, hash, err := utils.GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Minute)
+	err = s.h.APIKeys.CreateAPIKey(context.Background(), &database.APIKey{
+		UserID: &userID, Name: "expired", Prefix: prefix, KeyHash: hash,
+		Scopes: []string{"products:read"}, ExpiresAt: &past,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.expect(s.withKey(http.MethodGet, "/secure/products", expired, nil), http.StatusUnauthorized)
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	s := newTestServer(t)
+	userID := s.createUser("manager@example.com", "catalog_manager")
+	s.createUser("customer@example.com")
+	token := s.token("manager@example.com")
+
+	body := s.expect(s.do(http.MethodPost, "/secure/api-keys", token, map[string]any{
+		"name": "admin", "scopes": []string{"roles:manage"},
+	}), http.StatusBadRequest)
+	if body["error"] != "invalid scope roles:manage" {
+		t.Errorf("account scope: got %v", body)
+	}
+	body = s.expect(s.do(http.MethodPost, "/secure/api-keys", s.token("customer@example.com"), map[string]any{
+		"name": "writer", "scopes": []string{"products:write"},
+	}), http.StatusForbidden)
+	if body["error"] != "missing permission products:write" {
+		t.Errorf("scope beyond the token: got %v", body)
+	}
+
+	key, _ := s.createAPIKey("/secure/api-keys", token, "products:read", "products:write")
+	product := map[string]any{"product_name": "Lamp", "category": "home", "stock_quantity": 1, "price": 10}
+	s.expect(s.withKey(http.MethodPost, "/register-product", key, product), http.StatusOK)
+	s.expect(s.withKey(http.MethodGet, "/secure/me", key, nil), http.StatusForbidden)
+
+	// The key loses the scopes its owner is no longer granted
+	if err := s.h.Roles.RevokeRole(context.Background(), userID, "catalog_manager"); err != nil {
+		t.Fatal(err)
+	}
+	if !s.canList(key) {
+		t.Error("the key lost products:read, still granted to its owner")
+	}
+	body = s.expect(s.withKey(http.MethodPost, "/register-product", key, product), http.StatusForbidden)
+	if body["error"] != "missing permission products:write" {
+		t.Errorf("after the role was revoked: got %v", body)
+	}
+
+	// And stops working with its owner
+	if err := s.h.Users.DeleteUser(context.Background(), userID); err != nil {
+		t.Fatal(err)
+	}
+	s.expect(s.withKey(http.MethodGet, "/secure/products", key, nil), http.StatusUnauthorized)
+}
+
+func TestServiceAPIKeys(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("admin@example.com", "admin")
+	s.createUser("manager@example.com", "catalog_manager")
+	admin, manager := s.token("admin@example.com"), s.token("manager@example.com")
+
+	s.expect(s.do(http.MethodPost, "/admin/api-keys", manager, map[string]any{
+		"name": "erp-sync", "scopes": []string{"products:read"},
+	}), http.StatusForbidden)
+
+	key, id := s.createAPIKey("/admin/api-keys", admin, "products:read", "products:write")
+	product := map[string]any{"product_name": "Lamp", "category": "home", "stock_quantity": 1, "price": 10}
+	s.expect(s.withKey(http.MethodPost, "/register-product", key, product), http.StatusOK)
+	s.expect(s.withKey(http.MethodGet, "/admin/api-keys", key, nil), http.StatusForbidden)
+
+	// Service keys are listed apart from the keys of the admin
+	if keys := s.expect(s.do(http.MethodGet, "/admin/api-keys", admin, nil), http.StatusOK)["api_keys"].([]any); len(keys) != 1 {
+		t.Errorf("got %d service keys, want 1", len(keys))
+	}
+	if keys := s.expect(s.do(http.MethodGet, "/secure/api-keys", admin, nil), http.StatusOK)["api_keys"].([]any); len(keys) != 0 {
+		t.Errorf("got %d keys of the admin, want 0", len(keys))
+	}
+
+	// Only the admin endpoint revokes keys of someone else
+	userKey, userKeyID := s.createAPIKey("/secure/api-keys", manager, "products:read")
+	s.expect(s.do(http.MethodDelete, "/secure/api-keys/"+strconv.Itoa(id), manager, nil), http.StatusNotFound)
+	s.expect(s.do(http.MethodDelete, "/secure/api-keys/"+strconv.Itoa(userKeyID), admin, nil), http.StatusNotFound)
+	s.expect(s.do(http.MethodDelete, "/admin/api-keys/"+strconv.Itoa(userKeyID), admin, nil), http.StatusOK)
+	s.expect(s.do(http.MethodDelete, "/admin/api-keys/"+strconv.Itoa(id), admin, nil), http.StatusOK)
+	s.expect(s.withKey(http.MethodGet, "/secure/products", userKey, nil), http.StatusUnauthorized)
+	s.expect(s.withKey(http.MethodGet, "/secure/products", key, nil), http.StatusUnauthorized)
+}
@@ -1,26 +1,96 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"strconv"
+	"sync"
+	"time"
 
+	"github.com/0xSumeet/go_api/internal/configs"
+	"github.com/0xSumeet/go_api/internal/cursor"
 	"github.com/0xSumeet/go_api/internal/database"
+	"github.com/0xSumeet/go_api/internal/health"
+	"github.com/0xSumeet/go_api/internal/lockout"
+	"github.com/0xSumeet/go_api/internal/mailer"
+	"github.com/0xSumeet/go_api/internal/oidc"
+	"github.com/0xSumeet/go_api/internal/passwordpolicy"
+	"github.com/0xSumeet/go_api/internal/rbac"
 	"github.com/0xSumeet/go_api/pkg/utils"
 
 	"github.com/gin-gonic/gin"
 	_ "github.com/lib/pq"
 )
 
-func Home(c *gin.Context) {
+// Handler holds the dependencies shared by the HTTP handlers, the repositories
+// come from the embedded store so tests can use the in-memory one
+type Handler struct {
+	Config *config.Config
+	*database.Store
+	// Ready reports whether the server accepts traffic, nil means always
+	Ready func() bool
+	// Now is the clock the TOTP codes are checked against
+	Now func() time.Time
+	// Health holds the dependency checks of /readyz
+	Health *health.Registry
+	// Keys sign and verify the JWT tokens
+	Keys *utils.KeySet
+	// Mailer sends the account emails
+	Mailer mailer.Mailer
+	// Lockout throttles the logins after failed attempts
+	Lockout *lockout.Guard
+	// ResetEmails and ResetIPs throttle the password reset requests by email
+	// and by client IP, MagicLinkIPs the login link requests by client IP
+	ResetEmails  *lockout.Limiter
+	ResetIPs     *lockout.Limiter
+	MagicLinkIPs *lockout.Limiter
+	// Passwords hashes and verifies the user passwords
+	Passwords *utils.Passwords
+	// PasswordPolicy checks the new passwords
+	PasswordPolicy *passwordpolicy.Policy
+	// OIDC are the OpenID Connect providers users can log in with, by name
+	OIDC oidc.Providers
+	// Cursors signs the cursors of the product listing
+	Cursors *cursor.Signer
+
+	// background tracks the work done after responding, see Wait
+	background sync.WaitGroup
+}
+
+// New returns a handler signing tokens with the HS256 jwt secret, logging the
+// emails and without breached password list, replace Keys, Mailer and
+// PasswordPolicy to use asymmetric keys, SMTP or the list
+func New(cfg *config.Config, store *database.Store) *Handler {
+	return &Handler{
+		Config:  cfg,
+		Store:   store,
+		Now:     time.Now,
+		Keys:    utils.NewSecretKeySet(cfg.JWTSecret),
+		Mailer:  mailer.NewOutboxMailer(""),
+		Lockout: lockout.New(store.LoginAttempts, cfg.Auth.Lockout),
+
+		ResetEmails:  lockout.NewLimiter(1, cfg.Auth.PasswordResetInterval.Duration),
+		ResetIPs:     lockout.NewLimiter(cfg.Auth.PasswordResetIPLimit, cfg.Auth.Lockout.Window.Duration),
+		MagicLinkIPs: lockout.NewLimiter(cfg.Auth.MagicLinkIPLimit, cfg.Auth.Lockout.Window.Duration),
+
+		Passwords:      utils.NewPasswords(cfg.Auth.PasswordHashing),
+		PasswordPolicy: passwordpolicy.New(cfg.Auth.PasswordPolicy, nil),
+		OIDC:           oidc.NewProviders(cfg),
+		Cursors:        cursor.NewSigner(cfg.Pagination.CursorSecret),
+	}
+}
+
+func (h *Handler) Home(c *gin.Context) {
 	c.JSON(200, map[string]any{
 		"message": "home page",
 	})
 }
 
-func GetProducts(c *gin.Context) {
+func (h *Handler) GetProducts(c *gin.Context) {
 	// Run the query function GetProducts()
-	queryResult, err := database.GetProducts()
+	queryResult, err := h.Products.GetProducts(c.Request.Context())
 	if err != nil {
 		c.JSON(
 			http.StatusInternalServerError,
@@ -29,7 +99,7 @@ func GetProducts(c *gin.Context) {
 		return
 	}
 	// total product count in header
-	count, err := database.GetTotalProductsCount()
+	count, err := h.Products.GetTotalProductsCount(c.Request.Context())
 	if err != nil {
 		c.JSON(
 			http.StatusInternalServerError,
@@ -44,7 +114,7 @@ func GetProducts(c *gin.Context) {
 	c.JSON(http.StatusOK, queryResult)
 }
 
-func UpdateProduct(c *gin.Context) {
+func (h *Handler) UpdateProduct(c *gin.Context) {
 	// Get the 'id' parameter from the URL and convert it to an integer
 	idParam := c.Param("id")
 
@@ -69,8 +139,19 @@ func UpdateProduct(c *gin.Context) {
 	}
 
 	product.ID = id
-	updatedProduct, err := database.UpdateProductField(&product)
-	if err != nil {
+	version, ok := h.writeVersion(c, id)
+	if !ok {
+		return
+	}
+	product.Version = version
+	updatedProduct, err := h.Products.UpdateProductField(c.Request.Context(), &product)
+	if errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusNotFound, map[string]any{"error": "product not found"})
+		return
+	} else if errors.Is(err, database.ErrVersionMismatch) {
+		preconditionFailed(c)
+		return
+	} else if err != nil {
 		c.JSON(
 			http.StatusInternalServerError,
 			map[string]any{"message": "Could not update product", "error": err.Error()},
@@ -78,10 +159,11 @@ func UpdateProduct(c *gin.Context) {
 		return
 	}
 
+	c.Header("ETag", productETag(updatedProduct.Version))
 	c.JSON(http.StatusOK, map[string]any{"message": "success", "data": updatedProduct})
 }
 
-func GetProductById(c *gin.Context) {
+func (h *Handler) GetProductById(c *gin.Context) {
 	// Get the 'id' parameter from the URL and convert it to an integer
 	idParam := c.Param("id")
 
@@ -93,8 +175,11 @@ func GetProductById(c *gin.Context) {
 	}
 
 	// Query the database
-	queryResult, err := database.GetProductByID(id)
-	if err != nil {
+	queryResult, err := h.Products.GetProductByID(c.Request.Context(), id)
+	if errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusNotFound, map[string]any{"error": "product not found"})
+		return
+	} else if err != nil {
 		c.JSON(
 			http.StatusInternalServerError,
 			map[string]any{"message": "error getting product", "error": err.Error()},
@@ -102,8 +187,16 @@ func GetProductById(c *gin.Context) {
 		return
 	}
 
+	// The ETag changes with every write, a client holding it needs no body
+	etag := productETag(queryResult.Version)
+	c.Header("ETag", etag)
+	if header := c.GetHeader("If-None-Match"); header != "" && matchETag(header, etag, true) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
 	// Count the total product for headers
-	count, err := database.GetTotalProductsCount()
+	count, err := h.Products.GetTotalProductsCount(c.Request.Context())
 	if err != nil {
 		c.JSON(
 			http.StatusInternalServerError,
@@ -118,7 +211,7 @@ func GetProductById(c *gin.Context) {
 	c.JSON(http.StatusOK, queryResult)
 }
 
-func SignUp(c *gin.Context) {
+func (h *Handler) SignUp(c *gin.Context) {
 	/*
 		type userRequest struct {
 			Email    string `json:"email"`
@@ -147,8 +240,16 @@ func SignUp(c *gin.Context) {
 		return
 	}
 
+	if !h.checkPasswordPolicy(c, user.Password, user.Email, user.Name) {
+		return
+	}
+
 	// Check if email exist
-	userExist, err := database.CheckIfEmailExists(user)
+	userExist, err := h.Users.CheckIfEmailExists(c.Request.Context(), user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": err.Error()})
+		return
+	}
 	if userExist {
 		message := fmt.Sprintf("this email alreadyy exists")
 		c.JSON(http.StatusConflict, map[string]any{"error": message})
@@ -156,8 +257,7 @@ func SignUp(c *gin.Context) {
 	}
 
 	// Password Hashing
-	hashedPassword, err := utils.GenerateHash(user.Password)
-	fmt.Println(hashedPassword)
+	hashedPassword, err := h.Passwords.Hash(user.Password)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, map[string]any{"error": "Could not hash password"})
 		return
@@ -167,8 +267,17 @@ func SignUp(c *gin.Context) {
 	user.Password = hashedPassword
 
 	// Insert New User
-	_, err = database.InsertUser(user)
-	if err != nil {
+	_, err = h.Users.CreateNewUser(c.Request.Context(), &user)
+	if errors.Is(err, database.ErrEmailExists) {
+		c.JSON(http.StatusConflict, map[string]any{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": err.Error()})
+		return
+	}
+
+	// Every new account starts as a customer
+	if err := h.Roles.GrantRole(c.Request.Context(), user.ID, rbac.DefaultRole); err != nil {
 		c.JSON(http.StatusInternalServerError, map[string]any{"error": err.Error()})
 		return
 	}
@@ -178,7 +287,7 @@ func SignUp(c *gin.Context) {
 	c.JSON(http.StatusCreated, map[string]any{"message": userCreated, "status": "success"})
 }
 
-func Login(c *gin.Context) {
+func (h *Handler) Login(c *gin.Context) {
 	var user database.User
 	//	var err error
 
@@ -197,25 +306,55 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	// Query the database for the stored password using FetchPasswordHash function and
-	// fetch the hash password
-	hashPassword, err := database.FetchPasswordHash(user)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, map[string]any{"error": err.Error()})
+	// Refuse the attempt while the account or the client IP is locked out
+	if !h.checkLockout(c, user.Email) {
 		return
 	}
 
-	userPassword := user.Password
+	// Fetch the user with the stored password hash
+	storedUser, err := h.Users.GetUserByEmail(c.Request.Context(), user.Email)
+	if errors.Is(err, database.ErrNotFound) {
+		// Verifying a password anyway keeps the response time of unknown emails
+		// from revealing which accounts exist
+		h.Passwords.VerifyDummy(user.Password)
+		h.recordLoginFailure(c, nil, user.Email)
+		c.JSON(http.StatusUnauthorized, map[string]any{"error": "invalid email or password"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
 
 	// Compare the user input password with the fetched password
-	_, err = utils.CompareHashPasswords(hashPassword, userPassword)
+	ok, rehash, err := h.Passwords.Verify(storedUser.Password, user.Password)
+	if err != nil || !ok {
+		h.recordLoginFailure(c, &storedUser.ID, user.Email)
+		c.JSON(http.StatusUnauthorized, map[string]any{"error": "invalid email or password"})
+		return
+	}
+	if rehash {
+		h.rehashPassword(c.Request.Context(), storedUser, user.Password)
+	}
+
+	// Checked after the password so the response does not reveal the account
+	if h.Config.Auth.RequireVerifiedEmail && !storedUser.EmailVerified() {
+		c.JSON(http.StatusForbidden, map[string]any{"error": "email address not verified"})
+		return
+	}
+
+	// With 2FA enabled the password only opens a challenge for the code
+	twoFactor, err := h.twoFactorEnabled(c.Request.Context(), storedUser.ID)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, map[string]any{"error": "invlaid password"})
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+	if twoFactor {
+		h.startTwoFactorChallenge(c, storedUser, utils.AMRPassword)
 		return
 	}
 
-	// Generate the JWT Token
-	token, err := utils.GenerateJWT(user.Name)
+	// Generate the access and refresh tokens
+	tokens, err := h.issueTokens(c, storedUser, "", []string{utils.AMRPassword})
 	if err != nil {
 		c.JSON(
 			http.StatusInternalServerError,
@@ -224,15 +363,30 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	// Send the token as response
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Successfully logged in",
-		"token":   token,
-		"status":  "success",
-	})
+	if err := h.Lockout.Succeed(c.Request.Context(), storedUser.ID, storedUser.Email, c.ClientIP()); err != nil {
+		log.Printf("Error recording the login of user %d: %s", storedUser.ID, err)
+	}
+
+	// Send the tokens as response
+	c.JSON(http.StatusOK, loginResponse(tokens))
 }
 
-func GetProductsByLimit(c *gin.Context) {
+// loginResponse is the body returned with the tokens of a new session
+func loginResponse(tokens *tokenPair) gin.H {
+	response := gin.H{
+		"message":       "Successfully logged in",
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+		"status":        "success",
+	}
+	if len(tokens.WithheldRoles) > 0 {
+		response["two_factor_required_roles"] = tokens.WithheldRoles
+	}
+	return response
+}
+
+func (h *Handler) GetProductsByLimit(c *gin.Context) {
 	// Get page number from query parameters (defaults to 1 if not provided)
 	pageStr := c.DefaultQuery("page", "1")
 	page, err := strconv.Atoi(pageStr)
@@ -247,39 +401,70 @@ func GetProductsByLimit(c *gin.Context) {
 	_, err = utils.ValidatePageNumber(page)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
 	}
 
-	limitStr := c.DefaultQuery("limit", "10")
+	limitStr := c.DefaultQuery("limit", strconv.Itoa(h.Config.Pagination.DefaultLimit))
 	limit, err := strconv.Atoi(limitStr)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, map[string]any{"error": "error converting limit to int"})
+		return
+	}
+
+	// Validate data limit, the default and maximum limits come from the configuration
+	limit = utils.ValidateDataLimit(limit, h.Config.Pagination)
+
+	query, err := productQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
+	}
+
+	// A cursor parameter, even empty for the first page, selects the keyset pagination
+	if _, ok := c.GetQuery("cursor"); ok {
+		if _, ok := c.GetQuery("page"); ok {
+			c.JSON(http.StatusBadRequest, map[string]any{"error": "page and cursor cannot be used together"})
+			return
+		}
+		h.listProductsByCursor(c, query, limit)
+		return
 	}
 
-	// Validate data limit, by default, the return data limit is 10 and max limit is 20
-	_ = utils.ValidateDataLimit(limit)
+	// Count the filtered products for headers
+	count, err := h.Products.CountProducts(c.Request.Context(), query.Filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"message": "error counting products", "error": err.Error()})
+		return
+	}
+	c.Header("X-Total-Count", strconv.Itoa(count))
 
-	products, err := database.PaginateData(page, limit)
+	products, err := h.Products.PaginateData(c.Request.Context(), query, page, limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, map[string]any{"error": "Cannot paginate data"})
 		return
 	}
 
-	// Return products as JSON
-	c.JSON(http.StatusOK, products)
+	// Return products as JSON, a page past the end or without match is empty
 	if products == nil {
-		c.JSON(
-			http.StatusBadRequest,
-			map[string]any{"message": "no products available", "status": "failure"},
-		)
-	} else {
-		c.JSON(http.StatusOK, map[string]any{"message": "Products", "status": "success"})
+		products = []database.Product{}
 	}
+	c.JSON(http.StatusOK, products)
 }
 
 type UserResponse struct {
-	ID    int    `json:"id"`
-	Email string `json:"email"`
-	Name  string `json:"name"`
+	ID            int    `json:"id"`
+	Email         string `json:"email"`
+	Name          string `json:"name"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+func newUserResponse(user *database.User) UserResponse {
+	return UserResponse{
+		ID:            user.ID,
+		Email:         user.Email,
+		Name:          user.Name,
+		EmailVerified: user.EmailVerified(),
+	}
 }
 
 /*
@@ -291,7 +476,7 @@ type UserRequest struct {
 }
 */
 
-func SignUpTry(c *gin.Context) {
+func (h *Handler) SignUpTry(c *gin.Context) {
 	var userRequest struct {
 		ID       int    `json:"id"`
 		Email    string `json:"email"`
@@ -299,7 +484,6 @@ func SignUpTry(c *gin.Context) {
 		Password string `json:"password"`
 	}
 
-	var user database.User
 	var err error
 
 	// Bind JSON input to the user struct
@@ -323,6 +507,9 @@ func SignUpTry(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, map[string]any{"error": "please provide the password"})
 		return
 	}
+	if !h.checkPasswordPolicy(c, userRequest.Password, userRequest.Email, userRequest.Name) {
+		return
+	}
 
 	//	return false, nil
 	/*
@@ -342,7 +529,11 @@ func SignUpTry(c *gin.Context) {
 	}
 
 	// Check if email exist
-	emailExist, err := database.CheckIfEmailExists(email)
+	emailExist, err := h.Users.CheckIfEmailExists(c.Request.Context(), email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": err.Error()})
+		return
+	}
 	if emailExist {
 		message := fmt.Sprintf("this email alreadyy exists")
 		c.JSON(http.StatusConflict, map[string]any{"error": message})
@@ -350,35 +541,39 @@ func SignUpTry(c *gin.Context) {
 	}
 
 	// Password Hashing
-	hashedPassword, err := utils.GenerateHash(user.Password)
+	hashedPassword, err := h.Passwords.Hash(userRequest.Password)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, map[string]any{"error": "Could not hash password"})
 		return
 	}
 
-	// Store the password hash in user.Password field
-	user.Password = hashedPassword
-
-	response, err := database.CreateNewUser(&database.User{
+	response, err := h.Users.CreateNewUser(c.Request.Context(), &database.User{
 		ID:       userRequest.ID,
 		Name:     userRequest.Name,
 		Email:    userRequest.Email,
-		Password: user.Password,
+		Password: hashedPassword,
 	})
-	/*
-		// Insert New User
-		_, err = database.InsertUser(user)
-	*/if err != nil {
+	if errors.Is(err, database.ErrEmailExists) {
+		c.JSON(http.StatusConflict, map[string]any{"error": err.Error()})
+		return
+	} else if err != nil {
 		c.JSON(http.StatusInternalServerError, map[string]any{"error": err.Error()})
 		return
 	}
 
-	userResponse := UserResponse{
-		ID:    response.ID,
-		Email: response.Email,
-		Name:  response.Name,
+	// Every new account starts as a customer
+	if err := h.Roles.GrantRole(c.Request.Context(), response.ID, rbac.DefaultRole); err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": err.Error()})
+		return
 	}
 
+	// The account is created anyway, the user can ask for another link
+	if err := h.sendVerificationEmail(c.Request.Context(), response); err != nil {
+		log.Printf("Error sending the verification email of user %d: %s", response.ID, err)
+	}
+
+	userResponse := newUserResponse(response)
+
 	/*
 		// Respond with success
 		userCreated := fmt.Sprintf("%s created successfully", Response.Name)
@@ -388,43 +583,19 @@ func SignUpTry(c *gin.Context) {
 	c.JSON(http.StatusCreated, map[string]any{"message": userResponse, "status": "success"})
 }
 
-func UpdateUser(c *gin.Context) {
-	var userRequest struct {
-		ID    int    `json:"id"`
-		Email string `json:"email"`
-		Name  string `json:"name"`
-	}
-
-	// Bind JSON input to the user struct
-	if err := c.ShouldBindJSON(&userRequest); err != nil {
-		c.JSON(http.StatusBadRequest, map[string]any{"error": err.Error()})
-		return
-	}
-
-	response, err := database.UpdateUser(&database.User{
-		ID:    userRequest.ID,
-		Email: userRequest.Email,
-		Name:  userRequest.Name,
-	})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, map[string]any{"error": err.Error()})
-		return
-	}
-	c.JSON(http.StatusOK, map[string]any{"message": response, "status": "success"})
-}
-
-func AddProduct(c *gin.Context) {
+func (h *Handler) AddProduct(c *gin.Context) {
 	var product database.Product
 
 	if err := c.ShouldBindJSON(&product); err != nil {
 		c.JSON(http.StatusBadRequest, map[string]any{"error": err.Error()})
 		return
 	}
-	query, err := database.CreateProduct(&product)
+	query, err := h.Products.CreateProduct(c.Request.Context(), &product)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, map[string]any{"error": err.Error()})
 		return
 	}
 
+	c.Header("ETag", productETag(query.Version))
 	c.JSON(http.StatusOK, map[string]any{"message": "success", "data": query})
 }
@@ -0,0 +1,74 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestEmailCase(t *testing.T) {
+	s := newTestServer(t)
+	s.expect(s.do(http.MethodPost, "/signup", "", map[string]any{
+		"email":    " Ada@Example.com",
+		"name":     "Ada",
+		"password": testPassword,
+	}), http.StatusCreated)
+
+	s.expect(s.do(http.MethodPost, "/signup", "", map[string]any{
+		"email":    "ADA@example.com",
+		"name":     "Ada",
+		"password": testPassword,
+	}), http.StatusConflict)
+
+	token := s.token("ada@EXAMPLE.com")
+	if got := s.me(token)["email"]; got != "ada@example.com" {
+		t.Errorf("got email %v, want it normalized", got)
+	}
+}
+
+func TestLoginFailuresLookAlike(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("ada@example.com")
+
+	unknown := s.do(http.MethodPost, "/login", "", map[string]any{"email": "bob@example.com", "password": testPassword})
+	wrong := s.do(http.MethodPost, "/login", "", map[string]any{"email": "ada@example.com", "password": "wrong password"})
+	if unknown.Code != http.StatusUnauthorized || wrong.Code != http.StatusUnauthorized {
+		t.Fatalf("got %d and %d, want 401", unknown.Code, wrong.Code)
+	}
+	if unknown.Body.String() != wrong.Body.String() {
+		t.Errorf("an unknown email got %s, a wrong password %s", unknown.Body, wrong.Body)
+	}
+}
+
+func TestLoginUpgradesBcryptHash(t *testing.T) {
+	s := newTestServer(t)
+	userID := s.createUser("ada@example.com")
+
+	// An account created before argon2id still has a bcrypt hash
+	ctx := context.Background()
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.h.Users.UpdatePassword(ctx, userID, string(hash)); err != nil {
+		t.Fatal(err)
+	}
+
+	s.expect(s.do(http.MethodPost, "/login", "", map[string]any{"email": "ada@example.com", "password": "wrong password"}), http.StatusUnauthorized)
+	if user, _ := s.h.Users.GetUserByID(ctx, userID); user.Password != string(hash) {
+		t.Fatal("a failed login replaced the hash")
+	}
+
+	s.login("ada@example.com")
+	user, err := s.h.Users.GetUserByID(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(user.Password, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Errorf("got hash %q after the login, want argon2id", user.Password)
+	}
+	s.login("ada@example.com")
+}
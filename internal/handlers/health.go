@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/0xSumeet/go_api/internal/health"
+	"github.com/gin-gonic/gin"
+)
+
+// Healthz reports that the process is alive, it never checks dependencies
+func (h *Handler) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, map[string]any{"status": health.StatusUp})
+}
+
+// Readyz fails as soon as the server starts shutting down or when one of the
+// registered dependency checks fails, so the load balancer stops routing to it
+func (h *Handler) Readyz(c *gin.Context) {
+	if h.Ready != nil && !h.Ready() {
+		c.JSON(
+			http.StatusServiceUnavailable,
+			map[string]any{"status": health.StatusDown, "error": "shutting down"},
+		)
+		return
+	}
+
+	report := health.Report{Status: health.StatusUp, Checks: []health.Result{}}
+	if h.Health != nil {
+		report = h.Health.Run(c.Request.Context())
+	}
+
+	if report.Status != health.StatusUp {
+		c.JSON(http.StatusServiceUnavailable, report)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
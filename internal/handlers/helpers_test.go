@@ -0,0 +1,228 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0xSumeet/go_api/internal/configs"
+	"github.com/0xSumeet/go_api/internal/database"
+	"github.com/0xSumeet/go_api/internal/handlers"
+	"github.com/0xSumeet/go_api/internal/mailer"
+	"github.com/0xSumeet/go_api/internal/routes"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testPassword follows the default password policy
+const testPassword = "correct horse battery"
+
+// testNow is the time the TOTP codes are checked at, in the middle of a step
+var testNow = time.Date(2026, 10, 1, 12, 0, 15, 0, time.UTC)
+
+// testServer serves the routes from the memory store, the emails are kept in
+// the outbox
+type testServer struct {
+	t      *testing.T
+	cfg    *config.Config
+	h      *handlers.Handler
+	engine *gin.Engine
+	outbox *mailer.OutboxMailer
+}
+
+// newTestServer starts from the default configuration with cheap password
+// hashes, no role requiring 2FA and the TOTP clock at testNow, configure
+// changes the configuration before the handler is built
+func newTestServer(t *testing.T, configure ...func(cfg *config.Config)) *testServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	cfg := config.Default()
+	cfg.Auth.PasswordHashing.Argon2Memory = 1024
+	cfg.Auth.PasswordHashing.Argon2Iterations = 1
+	cfg.Auth.PasswordHashing.Argon2Parallelism = 1
+	cfg.Auth.TwoFactorRoles = nil
+	for _, f := range configure {
+		f(cfg)
+	}
+
+	h := handlers.New(cfg, database.NewMemoryStore())
+	h.Now = func() time.Time { return testNow }
+	outbox := mailer.NewOutboxMailer(t.TempDir())
+	h.Mailer = outbox
+	engine := gin.New()
+	routes.SetupRoutes(engine, h)
+
+	return &testServer{t: t, cfg: cfg, h: h, engine: engine, outbox: outbox}
+}
+
+// do serves a request, body is sent as is when it is a string and encoded to
+// JSON otherwise. headers are name and value pairs.
+func (s *testServer) do(method, path, token string, body any, headers ...string) *httptest.ResponseRecorder {
+	s.t.Helper()
+
+	var data []byte
+	switch body := body.(type) {
+	case nil:
+	case string:
+		data = []byte(body)
+	default:
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			s.t.Fatalf("encoding the body: %v", err)
+		}
+	}
+
+	req := httptest.NewRequest(method, path, bytes.NewReader(data))
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+
+	w := httptest.NewRecorder()
+	s.engine.ServeHTTP(w, req)
+	return w
+}
+
+// expect fails the test when the response does not have the status and
+// returns its JSON object
+func (s *testServer) expect(w *httptest.ResponseRecorder, status int) map[string]any {
+	s.t.Helper()
+	if w.Code != status {
+		s.t.Fatalf("got status %d, want %d: %s", w.Code, status, w.Body.String())
+	}
+	return decode(s.t, w)
+}
+
+func decode(t *testing.T, w *httptest.ResponseRecorder) map[string]any {
+	t.Helper()
+	var body map[string]any
+	if w.Body.Len() > 0 {
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decoding %q: %v", w.Body.String(), err)
+		}
+	}
+	return body
+}
+
+// createUser signs a user up with testPassword, verifies the email and grants
+// the roles besides customer
+func (s *testServer) createUser(email string, roles ...string) int {
+	s.t.Helper()
+	s.expect(s.do(http.MethodPost, "/signup", "", map[string]any{
+		"email":    email,
+		"name":     "Test User",
+		"password": testPassword,
+	}), http.StatusCreated)
+
+	ctx := context.Background()
+	user, err := s.h.Users.GetUserByEmail(ctx, email)
+	if err != nil {
+		s.t.Fatalf("getting %s: %v", email, err)
+	}
+	if err := s.h.Users.MarkEmailVerified(ctx, user.ID); err != nil {
+		s.t.Fatalf("verifying %s: %v", email, err)
+	}
+	for _, role := range roles {
+		if err := s.h.Roles.GrantRole(ctx, user.ID, role); err != nil {
+			s.t.Fatalf("granting %s to %s: %v", role, email, err)
+		}
+	}
+	return user.ID
+}
+
+// login logs a user in with testPassword and returns the response
+func (s *testServer) login(email string) map[string]any {
+	s.t.Helper()
+	return s.expect(s.do(http.MethodPost, "/login", "", map[string]any{
+		"email":    email,
+		"password": testPassword,
+	}), http.StatusOK)
+}
+
+// token logs a user in and returns the access token
+func (s *testServer) token(email string) string {
+	s.t.Helper()
+	return s.login(email)["token"].(string)
+}
+
+// mails waits for the emails sent in the background and returns those to
+// address containing text
+func (s *testServer) mails(address, text string) []mailer.Message {
+	s.t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.h.Wait(ctx); err != nil {
+		s.t.Fatalf("waiting for the background work: %v", err)
+	}
+
+	var messages []mailer.Message
+	for _, message := range s.outbox.Messages() {
+		if message.To == address && strings.Contains(message.Body, text) {
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
+
+// mail returns the last email sent to address containing text
+func (s *testServer) mail(address, text string) mailer.Message {
+	s.t.Helper()
+	// The emails are sent in the background, not always in order
+	messages := s.mails(address, text)
+	if len(messages) == 0 {
+		s.t.Fatalf("no email to %s containing %q", address, text)
+	}
+	return messages[len(messages)-1]
+}
+
+// linkToken returns the token of the link to path in an email
+func linkToken(t *testing.T, message mailer.Message, path string) string {
+	t.Helper()
+	marker := path + "?token="
+	i := strings.Index(message.Body, marker)
+	if i < 0 {
+		t.Fatalf("no %s link in %q", path, message.Body)
+	}
+	return strings.Fields(message.Body[i+len(marker):])[0]
+}
+
+// claims decodes the payload of a JWT without checking it
+func claims(t *testing.T, token string) map[string]any {
+	t.Helper()
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("%q is not a JWT", token)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatalf("decoding the JWT payload: %v", err)
+	}
+	var values map[string]any
+	if err := json.Unmarshal(payload, &values); err != nil {
+		t.Fatalf("decoding the JWT claims: %v", err)
+	}
+	return values
+}
+
+// stringList returns the string items of a JSON array
+func stringList(value any) []string {
+	items, _ := value.([]any)
+	list := make([]string, len(items))
+	for i, item := range items {
+		list[i] = fmt.Sprint(item)
+	}
+	return list
+}
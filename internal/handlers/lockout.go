@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/0xSumeet/go_api/internal/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxLoginAttemptsLimit bounds the history returned to the admins
+const maxLoginAttemptsLimit = 100
+
+// checkLockout answers 429 with Retry-After and returns false while the logins
+// on email or from the client IP are locked out
+func (h *Handler) checkLockout(c *gin.Context, email string) bool {
+	wait, err := h.Lockout.Check(c.Request.Context(), email, c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return false
+	}
+	if wait > 0 {
+		tooManyRequests(c, wait, "too many failed login attempts, try again later")
+		return false
+	}
+	return true
+}
+
+// tooManyRequests answers 429 with the seconds to wait in Retry-After
+func tooManyRequests(c *gin.Context, wait time.Duration, message string) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, map[string]any{
+		"error":       message,
+		"retry_after": seconds,
+	})
+}
+
+// recordLoginFailure records a failed attempt, the login is refused anyway so
+// an error is only logged
+func (h *Handler) recordLoginFailure(c *gin.Context, userID *int, email string) {
+	if err := h.Lockout.Fail(c.Request.Context(), userID, email, c.ClientIP()); err != nil {
+		log.Printf("Error recording a failed login: %s", err)
+	}
+}
+
+// UnlockUser resets the failed login attempts of a user
+func (h *Handler) UnlockUser(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": "Invalid user id"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	user, err := h.Users.GetUserByID(ctx, userID)
+	if errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusNotFound, map[string]any{"error": "user not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+
+	if err := h.Lockout.Unlock(ctx, user.ID, user.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]any{"message": "user unlocked", "status": "success"})
+}
+
+// GetLoginAttempts returns the latest login attempts of a user
+func (h *Handler) GetLoginAttempts(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": "Invalid user id"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": "Invalid limit"})
+		return
+	}
+	if limit > maxLoginAttemptsLimit {
+		limit = maxLoginAttemptsLimit
+	}
+
+	attempts, err := h.LoginAttempts.ListLoginAttempts(c.Request.Context(), userID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]any{"user_id": userID, "attempts": attempts})
+}
@@ -0,0 +1,38 @@
+package handlers_test
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestLoginLockout(t *testing.T) {
+	s := newTestServer(t)
+	userID := s.createUser("ada@example.com")
+	s.createUser("admin@example.com", "admin")
+	admin := s.token("admin@example.com")
+
+	wrong := map[string]any{"email": "ada@example.com", "password": "wrong password"}
+	for i := 0; i < s.cfg.Auth.Lockout.AccountThreshold; i++ {
+		s.expect(s.do(http.MethodPost, "/login", "", wrong), http.StatusUnauthorized)
+	}
+
+	// The right password is refused too while the account is locked
+	w := s.do(http.MethodPost, "/login", "", map[string]any{"email": "ada@example.com", "password": testPassword})
+	body := s.expect(w, http.StatusTooManyRequests)
+	retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+	if err != nil || retryAfter <= 0 {
+		t.Errorf("got Retry-After %q, want a number of seconds", w.Header().Get("Retry-After"))
+	}
+	if body["retry_after"] != float64(retryAfter) {
+		t.Errorf("got retry_after %v, want %d", body["retry_after"], retryAfter)
+	}
+
+	attempts := s.expect(s.do(http.MethodGet, "/admin/users/"+strconv.Itoa(userID)+"/login-attempts", admin, nil), http.StatusOK)
+	if got := len(attempts["attempts"].([]any)); got != s.cfg.Auth.Lockout.AccountThreshold {
+		t.Errorf("got %d login attempts, want %d", got, s.cfg.Auth.Lockout.AccountThreshold)
+	}
+
+	s.expect(s.do(http.MethodPost, "/admin/users/"+strconv.Itoa(userID)+"/unlock", admin, nil), http.StatusOK)
+	s.login("ada@example.com")
+}
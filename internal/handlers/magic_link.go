@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/0xSumeet/go_api/internal/database"
+	"github.com/0xSumeet/go_api/internal/mailer"
+	"github.com/0xSumeet/go_api/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestMagicLink emails a single use login link, at most once per magic link
+// interval for an email. The link is made after responding, so the response
+// and its time are the same whether the account exists or not.
+func (h *Handler) RequestMagicLink(c *gin.Context) {
+	var request struct {
+		Email string `json:"email"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil || request.Email == "" {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": "please provide the email"})
+		return
+	}
+
+	if wait := h.MagicLinkIPs.Allow(c.ClientIP()); wait > 0 {
+		tooManyRequests(c, wait, "too many login link requests, try again later")
+		return
+	}
+
+	h.runInBackground(func(ctx context.Context) {
+		h.sendMagicLink(ctx, request.Email)
+	})
+
+	c.JSON(http.StatusOK, map[string]any{
+		"message": "if the account exists, a login link has been sent",
+		"status":  "success",
+	})
+}
+
+// sendMagicLink emails a login link to the account of email, if any and unless
+// a link was sent within the interval. It runs after the response, so errors
+// are only logged.
+func (h *Handler) sendMagicLink(ctx context.Context, email string) {
+	user, err := h.Users.GetUserByEmail(ctx, email)
+	if errors.Is(err, database.ErrNotFound) {
+		return
+	} else if err != nil {
+		log.Printf("Error finding the account of a login link: %s", err)
+		return
+	}
+
+	latest, err := h.UserTokens.GetLatestUserToken(ctx, user.ID, database.TokenPurposeMagicLink)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		log.Printf("Error finding the last login link of user %d: %s", user.ID, err)
+		return
+	}
+	if err == nil && time.Since(latest.CreatedAt) < h.Config.Auth.MagicLinkInterval.Duration {
+		return
+	}
+
+	// Only the last requested link is valid
+	if err := h.UserTokens.DeleteUserTokens(ctx, user.ID, database.TokenPurposeMagicLink); err != nil {
+		log.Printf("Error replacing the login links of user %d: %s", user.ID, err)
+		return
+	}
+
+	token, tokenHash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		log.Printf("Error generating a login link token: %s", err)
+		return
+	}
+	err = h.UserTokens.CreateUserToken(ctx, &database.UserToken{
+		UserID:    user.ID,
+		Purpose:   database.TokenPurposeMagicLink,
+		TokenHash: tokenHash,
+		ExpiresAt: time.Now().Add(h.Config.Auth.MagicLinkTTL.Duration),
+	})
+	if err != nil {
+		log.Printf("Error storing the login link of user %d: %s", user.ID, err)
+		return
+	}
+
+	link := h.Config.PublicURL + "/login/magic?token=" + url.QueryEscape(token)
+	err = h.Mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Your login link",
+		Body: fmt.Sprintf(
+			"Hello %s,\n\nUse this link to log in:\n\n%s\n\nThe link expires in %s and works once. If you did not ask for it, ignore this email.",
+			user.Name, link, h.Config.Auth.MagicLinkTTL.Duration,
+		),
+	})
+	if err != nil {
+		log.Printf("Error sending email to %s: %s", user.Email, err)
+	}
+}
+
+// RedeemMagicLink exchanges the token of a login link for the same response as
+// Login. Following the link proves the email, so it is marked verified.
+func (h *Handler) RedeemMagicLink(c *gin.Context) {
+	var request struct {
+		Token string `json:"token"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil || request.Token == "" {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": "please provide the token"})
+		return
+	}
+
+	// Consuming the token makes a replayed link fail
+	ctx := c.Request.Context()
+	token, err := h.UserTokens.ConsumeUserToken(ctx, database.TokenPurposeMagicLink, utils.HashToken(request.Token))
+	if errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusUnauthorized, map[string]any{"error": "invalid or expired login link"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+
+	user, err := h.Users.GetUserByID(ctx, token.UserID)
+	if errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusUnauthorized, map[string]any{"error": "invalid or expired login link"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+
+	if !user.EmailVerified() {
+		if err := h.Users.MarkEmailVerified(ctx, user.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+			return
+		}
+		if user, err = h.Users.GetUserByID(ctx, user.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+			return
+		}
+	}
+
+	// The link replaces the password, not the second factor
+	h.completeLogin(c, user, utils.AMRMagicLink)
+}
+
+// completeLogin answers a login proven without the password, like Login after
+// the password check: it starts the 2FA challenge or issues the tokens. method
+// is the amr value of the proof.
+func (h *Handler) completeLogin(c *gin.Context, user *database.User, method string) {
+	ctx := c.Request.Context()
+	twoFactor, err := h.twoFactorEnabled(ctx, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+	if twoFactor {
+		h.startTwoFactorChallenge(c, user, method)
+		return
+	}
+
+	tokens, err := h.issueTokens(c, user, "", []string{method})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to generate JWT token"})
+		return
+	}
+
+	if err := h.Lockout.Succeed(ctx, user.ID, user.Email, c.ClientIP()); err != nil {
+		log.Printf("Error recording the login of user %d: %s", user.ID, err)
+	}
+
+	c.JSON(http.StatusOK, loginResponse(tokens))
+}
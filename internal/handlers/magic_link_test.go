@@ -0,0 +1,92 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/0xSumeet/go_api/internal/configs"
+)
+
+// requestMagicLink asks for a login link to email
+func (s *testServer) requestMagicLink(email string) *httptest.ResponseRecorder {
+	s.t.Helper()
+	return s.do(http.MethodPost, "/login/magic", "", map[string]any{"email": email})
+}
+
+// redeem exchanges the token of a login link
+func (s *testServer) redeem(token string) *httptest.ResponseRecorder {
+	s.t.Helper()
+	return s.do(http.MethodPost, "/login/magic/redeem", "", map[string]any{"token": token})
+}
+
+func TestMagicLink(t *testing.T) {
+	s := newTestServer(t)
+	s.expect(s.do(http.MethodPost, "/signup", "", map[string]any{
+		"email":    "ada@example.com",
+		"name":     "Ada",
+		"password": testPassword,
+	}), http.StatusCreated)
+
+	// An unknown email gets the same answer
+	known, unknown := s.requestMagicLink("Ada@example.com"), s.requestMagicLink("eve@example.com")
+	if known.Code != http.StatusOK || known.Body.String() != unknown.Body.String() {
+		t.Fatalf("got %d %s for an account and %d %s for none", known.Code, known.Body, unknown.Code, unknown.Body)
+	}
+	token := linkToken(t, s.mail("ada@example.com", "/login/magic"), "/login/magic")
+	if sent := len(s.mails("eve@example.com", "/login/magic")); sent != 0 {
+		t.Errorf("got %d emails to an unknown address", sent)
+	}
+
+	// Redeeming proves the email, a replayed link fails
+	login := s.expect(s.redeem(token), http.StatusOK)
+	if me := s.me(login["token"].(string)); me["email_verified"] != true {
+		t.Errorf("got %v after redeeming, want the email verified", me)
+	}
+	body := s.expect(s.redeem(token), http.StatusUnauthorized)
+	if body["error"] != "invalid or expired login link" {
+		t.Errorf("replayed link: got %v", body)
+	}
+	s.expect(s.redeem("unknown"), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodPost, "/login/magic/redeem", "", map[string]any{}), http.StatusBadRequest)
+}
+
+func TestMagicLinkEmailLimit(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("ada@example.com")
+
+	s.expect(s.requestMagicLink("ada@example.com"), http.StatusOK)
+	first := linkToken(t, s.mail("ada@example.com", "/login/magic"), "/login/magic")
+
+	// Within the interval the request is answered alike but sends nothing
+	s.expect(s.requestMagicLink("ada@example.com"), http.StatusOK)
+	if sent := len(s.mails("ada@example.com", "/login/magic")); sent != 1 {
+		t.Fatalf("got %d login links, want 1", sent)
+	}
+	s.expect(s.redeem(first), http.StatusOK)
+
+	// Without interval, a new link replaces the previous one
+	s.cfg.Auth.MagicLinkInterval = config.Duration{}
+	s.expect(s.requestMagicLink("ada@example.com"), http.StatusOK)
+	second := linkToken(t, s.mail("ada@example.com", "/login/magic"), "/login/magic")
+	s.expect(s.requestMagicLink("ada@example.com"), http.StatusOK)
+	third := linkToken(t, s.mail("ada@example.com", "/login/magic"), "/login/magic")
+	if second == third {
+		t.Fatal("the same link was sent twice")
+	}
+	s.expect(s.redeem(second), http.StatusUnauthorized)
+	s.expect(s.redeem(third), http.StatusOK)
+}
+
+func TestMagicLinkIPLimit(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) { cfg.Auth.MagicLinkIPLimit = 2 })
+
+	for _, email := range []string{"a@example.com", "b@example.com"} {
+		s.expect(s.requestMagicLink(email), http.StatusOK)
+	}
+	w := s.requestMagicLink("c@example.com")
+	body := s.expect(w, http.StatusTooManyRequests)
+	if w.Header().Get("Retry-After") == "" || body["retry_after"] == nil {
+		t.Errorf("got %v without the time to wait", body)
+	}
+}
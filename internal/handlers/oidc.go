@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/0xSumeet/go_api/internal/database"
+	"github.com/0xSumeet/go_api/internal/middleware"
+	"github.com/0xSumeet/go_api/internal/oidc"
+	"github.com/0xSumeet/go_api/internal/rbac"
+	"github.com/0xSumeet/go_api/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StartOIDCLogin returns the URL sending the user to the provider. The state is
+// returned too, the client keeps it to check the one coming back to the redirect URL.
+func (h *Handler) StartOIDCLogin(c *gin.Context) {
+	provider, ok := h.OIDC[c.Param("provider")]
+	if !ok {
+		c.JSON(http.StatusNotFound, map[string]any{"error": "unknown provider"})
+		return
+	}
+
+	state, stateHash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "could not generate state"})
+		return
+	}
+	nonce, err := utils.GenerateRandomString(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "could not generate state"})
+		return
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "could not generate state"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, challenge)
+	if err != nil {
+		log.Printf("Error starting the login with %s: %s", provider.Name, err)
+		c.JSON(http.StatusBadGateway, map[string]any{"error": "the provider is unavailable"})
+		return
+	}
+
+	ttl := h.Config.Auth.OIDCStateTTL.Duration
+	err = h.Identities.CreateOIDCLoginState(ctx, &database.OIDCLoginState{
+		StateHash:    stateHash,
+		Provider:     provider.Name,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(ttl),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]any{
+		"authorization_url": authURL,
+		"state":             state,
+		"expires_in":        int(ttl.Seconds()),
+	})
+}
+
+// FinishOIDCLogin exchanges the code the provider redirected with for the same
+// response as Login. The user is found by the provider subject, or else by the
+// email the provider verified, and created when there is none.
+func (h *Handler) FinishOIDCLogin(c *gin.Context) {
+	var request struct {
+		State string `json:"state"`
+		Code  string `json:"code"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil || request.State == "" || request.Code == "" {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": "please provide the state and the code"})
+		return
+	}
+
+	provider, ok := h.OIDC[c.Param("provider")]
+	if !ok {
+		c.JSON(http.StatusNotFound, map[string]any{"error": "unknown provider"})
+		return
+	}
+
+	// Consuming the state makes a replayed callback fail
+	ctx := c.Request.Context()
+	state, err := h.Identities.ConsumeOIDCLoginState(ctx, provider.Name, utils.HashToken(request.State))
+	if errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusUnauthorized, map[string]any{"error": "invalid or expired login state"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+
+	rawIDToken, err := provider.Exchange(ctx, request.Code, state.CodeVerifier)
+	if err == nil {
+		var idToken *oidc.IDToken
+		if idToken, err = provider.VerifyIDToken(ctx, rawIDToken, state.Nonce); err == nil {
+			h.loginWithIdentity(c, provider.Name, idToken)
+			return
+		}
+	}
+	log.Printf("Error logging in with %s: %s", provider.Name, err)
+	if errors.Is(err, oidc.ErrCodeRejected) || errors.Is(err, oidc.ErrInvalidIDToken) {
+		c.JSON(http.StatusUnauthorized, map[string]any{"error": "the provider login could not be verified"})
+		return
+	}
+	c.JSON(http.StatusBadGateway, map[string]any{"error": "the provider is unavailable"})
+}
+
+// loginWithIdentity logs in the user linked to the provider subject, linking or
+// creating one by verified email the first time
+func (h *Handler) loginWithIdentity(c *gin.Context, provider string, idToken *oidc.IDToken) {
+	ctx := c.Request.Context()
+	identity, err := h.Identities.GetIdentity(ctx, provider, idToken.Subject)
+	if err == nil {
+		// A user deleted since the identity was read takes it along, the
+		// provider account is then unknown again
+		user, err := h.Users.GetUserByID(ctx, identity.UserID)
+		if err == nil {
+			if err := h.Identities.TouchIdentity(ctx, identity.ID); err != nil {
+				log.Printf("Error recording the login of identity %d: %s", identity.ID, err)
+			}
+			h.completeLogin(c, user, utils.AMRFederated)
+			return
+		} else if !errors.Is(err, database.ErrNotFound) {
+			c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+			return
+		}
+	} else if !errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+
+	// An unverified email could belong to anyone, it cannot claim an account
+	if idToken.Email == "" || !idToken.EmailVerified {
+		c.JSON(http.StatusForbidden, map[string]any{"error": "the provider did not verify the email of this account"})
+		return
+	}
+
+	user, err := h.Users.GetUserByEmail(ctx, idToken.Email)
+	if errors.Is(err, database.ErrNotFound) {
+		if user, ok := h.createOIDCUser(c, idToken); ok {
+			h.linkIdentity(c, user, provider, idToken)
+		}
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+
+	// Whoever signed up with an email they do not own must not get the account
+	// of its owner, nor the owner theirs
+	if !user.EmailVerified() {
+		c.JSON(http.StatusConflict, map[string]any{"error": "an account with this email exists, verify its email before logging in with the provider"})
+		return
+	}
+	h.linkIdentity(c, user, provider, idToken)
+}
+
+// createOIDCUser creates a verified customer for the provider account, with a
+// random password the user can replace through a password reset
+func (h *Handler) createOIDCUser(c *gin.Context, idToken *oidc.IDToken) (*database.User, bool) {
+	password, err := utils.GenerateRandomString(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "could not generate password"})
+		return nil, false
+	}
+	hashedPassword, err := h.Passwords.Hash(password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "Could not hash password"})
+		return nil, false
+	}
+
+	name := idToken.Name
+	if name == "" {
+		name, _, _ = strings.Cut(idToken.Email, "@")
+	}
+	user := &database.User{Email: idToken.Email, Name: name, Password: hashedPassword}
+
+	ctx := c.Request.Context()
+	_, err = h.Users.CreateNewUser(ctx, user)
+	if errors.Is(err, database.ErrEmailExists) {
+		c.JSON(http.StatusConflict, map[string]any{"error": err.Error()})
+		return nil, false
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": err.Error()})
+		return nil, false
+	}
+	if err := h.Users.MarkEmailVerified(ctx, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return nil, false
+	}
+	if err := h.Roles.GrantRole(ctx, user.ID, rbac.DefaultRole); err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": err.Error()})
+		return nil, false
+	}
+
+	created, err := h.Users.GetUserByID(ctx, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return nil, false
+	}
+	return created, true
+}
+
+// linkIdentity links the provider account to user and logs them in
+func (h *Handler) linkIdentity(c *gin.Context, user *database.User, provider string, idToken *oidc.IDToken) {
+	now := time.Now()
+	err := h.Identities.CreateIdentity(c.Request.Context(), &database.Identity{
+		UserID:      user.ID,
+		Provider:    provider,
+		Subject:     idToken.Subject,
+		Email:       idToken.Email,
+		LastLoginAt: &now,
+	})
+	if errors.Is(err, database.ErrIdentityExists) {
+		c.JSON(http.StatusConflict, map[string]any{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+	h.completeLogin(c, user, utils.AMRFederated)
+}
+
+// ListIdentities returns the provider accounts linked to the authenticated user
+func (h *Handler) ListIdentities(c *gin.Context) {
+	userID, ok := auth.CurrentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, map[string]any{"error": "not authenticated"})
+		return
+	}
+
+	identities, err := h.Identities.ListUserIdentities(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+	c.JSON(http.StatusOK, map[string]any{"identities": identities})
+}
+
+// UnlinkIdentity removes a provider account of the authenticated user, the
+// next login with it links it again by email
+func (h *Handler) UnlinkIdentity(c *gin.Context) {
+	userID, ok := auth.CurrentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, map[string]any{"error": "not authenticated"})
+		return
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, map[string]any{"error": "identity not found"})
+		return
+	}
+
+	err = h.Identities.DeleteIdentity(c.Request.Context(), userID, id)
+	if errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusNotFound, map[string]any{"error": "identity not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+	c.JSON(http.StatusOK, map[string]any{"message": "identity unlinked", "status": "success"})
+}
@@ -0,0 +1,208 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+
+	"github.com/0xSumeet/go_api/internal/configs"
+	"github.com/0xSumeet/go_api/internal/database"
+	"github.com/0xSumeet/go_api/internal/oidc"
+	"github.com/0xSumeet/go_api/internal/oidc/oidctest"
+	"github.com/0xSumeet/go_api/pkg/utils"
+)
+
+// withProvider serves a fake provider the server logs in with as "fake"
+func (s *testServer) withProvider() *oidctest.Provider {
+	s.t.Helper()
+	provider, err := oidctest.New("client", "secret")
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	server := httptest.NewServer(provider)
+	s.t.Cleanup(server.Close)
+	provider.Issuer = server.URL
+
+	s.h.OIDC = oidc.Providers{"fake": oidc.NewProvider(config.OIDCProvider{
+		Name:         "fake",
+		Issuer:       server.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  s.cfg.PublicURL + "/login/oidc/fake/callback",
+	}, server.Client())}
+	return provider
+}
+
+// authorize starts a login with the fake provider and follows the
+// authorization URL, edit changes its query first. It returns the state and
+// the code the provider redirected with.
+func (s *testServer) authorize(edit func(query url.Values)) (string, string) {
+	s.t.Helper()
+	started := s.expect(s.do(http.MethodPost, "/login/oidc/fake", "", nil), http.StatusOK)
+
+	authURL, err := url.Parse(started["authorization_url"].(string))
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	if edit != nil {
+		query := authURL.Query()
+		edit(query)
+		authURL.RawQuery = query.Encode()
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL.String())
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	resp.Body.Close()
+	redirect, err := resp.Location()
+	if err != nil {
+		s.t.Fatalf("the provider did not redirect: %v", err)
+	}
+	if state := redirect.Query().Get("state"); state != started["state"] {
+		s.t.Fatalf("the provider redirected with state %q, want %q", state, started["state"])
+	}
+	return started["state"].(string), redirect.Query().Get("code")
+}
+
+// oidcLogin goes through the whole login with the fake provider
+func (s *testServer) oidcLogin(status int) map[string]any {
+	s.t.Helper()
+	state, code := s.authorize(nil)
+	return s.expect(s.do(http.MethodPost, "/login/oidc/fake/callback", "", map[string]any{"state": state, "code": code}), status)
+}
+
+// me returns the account of the token
+func (s *testServer) me(token string) map[string]any {
+	s.t.Helper()
+	return s.expect(s.do(http.MethodGet, "/secure/me", token, nil), http.StatusOK)
+}
+
+func TestOIDCLoginCreatesUser(t *testing.T) {
+	s := newTestServer(t)
+	provider := s.withProvider()
+	provider.SetUser(oidctest.User{Subject: "sub-1", Email: "Grace@Example.com", EmailVerified: true, Name: "Grace"})
+
+	login := s.oidcLogin(http.StatusOK)
+	token := login["token"].(string)
+	if amr := stringList(claims(t, token)["amr"]); !slices.Equal(amr, []string{utils.AMRFederated}) {
+		t.Errorf("got amr %v, want fed", amr)
+	}
+	me := s.me(token)
+	if me["email"] != "grace@example.com" || me["email_verified"] != true {
+		t.Errorf("got account %v, want the verified and normalized provider email", me)
+	}
+
+	// The next logins find the user by subject
+	again := s.oidcLogin(http.StatusOK)
+	if got := s.me(again["token"].(string))["id"]; got != me["id"] {
+		t.Errorf("got user %v on the second login, want %v", got, me["id"])
+	}
+}
+
+func TestOIDCLoginLinksAccount(t *testing.T) {
+	s := newTestServer(t)
+	provider := s.withProvider()
+	userID := s.createUser("ada@example.com")
+
+	// The email matches whatever its case
+	provider.SetUser(oidctest.User{Subject: "sub-ada", Email: "ADA@example.com ", EmailVerified: true})
+	login := s.oidcLogin(http.StatusOK)
+	token := login["token"].(string)
+	if got := s.me(token)["id"]; got != float64(userID) {
+		t.Fatalf("got user %v, want the existing account %d", got, userID)
+	}
+	identities := s.expect(s.do(http.MethodGet, "/secure/me/identities", token, nil), http.StatusOK)
+	if got := len(identities["identities"].([]any)); got != 1 {
+		t.Errorf("got %d identities, want 1", got)
+	}
+
+	// The password login still works
+	s.login("ada@example.com")
+}
+
+func TestOIDCLoginRefusals(t *testing.T) {
+	s := newTestServer(t)
+	provider := s.withProvider()
+
+	t.Run("unknown provider", func(t *testing.T) {
+		s.expect(s.do(http.MethodPost, "/login/oidc/other", "", nil), http.StatusNotFound)
+	})
+
+	t.Run("bad state", func(t *testing.T) {
+		_, code := s.authorize(nil)
+		s.expect(s.do(http.MethodPost, "/login/oidc/fake/callback", "", map[string]any{"state": "forged", "code": code}), http.StatusUnauthorized)
+	})
+
+	t.Run("replayed state", func(t *testing.T) {
+		state, code := s.authorize(nil)
+		s.expect(s.do(http.MethodPost, "/login/oidc/fake/callback", "", map[string]any{"state": state, "code": code}), http.StatusOK)
+		s.expect(s.do(http.MethodPost, "/login/oidc/fake/callback", "", map[string]any{"state": state, "code": code}), http.StatusUnauthorized)
+	})
+
+	t.Run("bad nonce", func(t *testing.T) {
+		state, code := s.authorize(func(query url.Values) { query.Set("nonce", "forged") })
+		s.expect(s.do(http.MethodPost, "/login/oidc/fake/callback", "", map[string]any{"state": state, "code": code}), http.StatusUnauthorized)
+	})
+
+	t.Run("bad code", func(t *testing.T) {
+		state, _ := s.authorize(nil)
+		s.expect(s.do(http.MethodPost, "/login/oidc/fake/callback", "", map[string]any{"state": state, "code": "forged"}), http.StatusUnauthorized)
+	})
+
+	t.Run("unverified email", func(t *testing.T) {
+		provider.SetUser(oidctest.User{Subject: "sub-unverified", Email: "eve@example.com", EmailVerified: false})
+		s.oidcLogin(http.StatusForbidden)
+		if _, err := s.h.Users.GetUserByEmail(context.Background(), "eve@example.com"); !errors.Is(err, database.ErrNotFound) {
+			t.Errorf("got %v, want no account for an unverified email", err)
+		}
+	})
+
+	t.Run("unverified account", func(t *testing.T) {
+		s.expect(s.do(http.MethodPost, "/signup", "", map[string]any{"email": "bob@example.com", "name": "Bob", "password": testPassword}), http.StatusCreated)
+		provider.SetUser(oidctest.User{Subject: "sub-bob", Email: "bob@example.com", EmailVerified: true})
+		s.oidcLogin(http.StatusConflict)
+	})
+}
+
+// staleIdentities returns an identity of a deleted user, as read right before
+// the user is deleted
+type staleIdentities struct {
+	database.IdentityRepository
+	identity database.Identity
+}
+
+func (r staleIdentities) GetIdentity(ctx context.Context, provider, subject string) (*database.Identity, error) {
+	if provider == r.identity.Provider && subject == r.identity.Subject {
+		identity := r.identity
+		return &identity, nil
+	}
+	return r.IdentityRepository.GetIdentity(ctx, provider, subject)
+}
+
+func TestOIDCLoginDeletedUser(t *testing.T) {
+	s := newTestServer(t)
+	provider := s.withProvider()
+	provider.SetUser(oidctest.User{Subject: "sub-1", Email: "grace@example.com", EmailVerified: true})
+	first := s.me(s.oidcLogin(http.StatusOK)["token"].(string))
+
+	identities, err := s.h.Identities.ListUserIdentities(context.Background(), int(first["id"].(float64)))
+	if err != nil || len(identities) != 1 {
+		t.Fatalf("got identities %v, %v", identities, err)
+	}
+	if err := s.h.Users.DeleteUser(context.Background(), int(first["id"].(float64))); err != nil {
+		t.Fatal(err)
+	}
+	s.h.Identities = staleIdentities{IdentityRepository: s.h.Identities, identity: identities[0]}
+
+	// The provider account is new again
+	second := s.me(s.oidcLogin(http.StatusOK)["token"].(string))
+	if second["id"] == first["id"] {
+		t.Errorf("got the deleted user %v back", first["id"])
+	}
+}
@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/0xSumeet/go_api/internal/database"
+	"github.com/0xSumeet/go_api/internal/mailer"
+	"github.com/0xSumeet/go_api/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// mailTimeout bounds the delivery of an email sent in the background
+const mailTimeout = 30 * time.Second
+
+// ForgotPassword emails a password reset link to the account, at most once per
+// password reset interval for an email. The link is made after responding, so
+// the response and its time are the same whether the email exists or not.
+func (h *Handler) ForgotPassword(c *gin.Context) {
+	var request struct {
+		Email string `json:"email"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil || request.Email == "" {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": "please provide the email"})
+		return
+	}
+
+	if wait := h.ResetIPs.Allow(c.ClientIP()); wait > 0 {
+		tooManyRequests(c, wait, "too many password reset requests, try again later")
+		return
+	}
+
+	if h.ResetEmails.Allow(database.NormalizeEmail(request.Email)) == 0 {
+		h.runInBackground(func(ctx context.Context) {
+			h.sendPasswordReset(ctx, request.Email)
+		})
+	}
+
+	c.JSON(http.StatusOK, map[string]any{
+		"message": "if the account exists, a password reset email has been sent",
+		"status":  "success",
+	})
+}
+
+// sendPasswordReset emails a reset link to the account of email, if any. It
+// runs after the response, so errors are only logged.
+func (h *Handler) sendPasswordReset(ctx context.Context, email string) {
+	user, err := h.Users.GetUserByEmail(ctx, email)
+	if errors.Is(err, database.ErrNotFound) {
+		return
+	} else if err != nil {
+		log.Printf("Error finding the account of a password reset: %s", err)
+		return
+	}
+
+	// Only the last requested link is valid
+	if err := h.UserTokens.DeleteUserTokens(ctx, user.ID, database.TokenPurposePasswordReset); err != nil {
+		log.Printf("Error replacing the password reset tokens of user %d: %s", user.ID, err)
+		return
+	}
+
+	token, tokenHash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		log.Printf("Error generating a password reset token: %s", err)
+		return
+	}
+	err = h.UserTokens.CreateUserToken(ctx, &database.UserToken{
+		UserID:    user.ID,
+		Purpose:   database.TokenPurposePasswordReset,
+		TokenHash: tokenHash,
+		ExpiresAt: time.Now().Add(h.Config.Auth.PasswordResetTTL.Duration),
+	})
+	if err != nil {
+		log.Printf("Error storing the password reset token of user %d: %s", user.ID, err)
+		return
+	}
+
+	link := h.Config.PublicURL + "/password/reset?token=" + url.QueryEscape(token)
+	err = h.Mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Hello %s,\n\nUse this link to choose a new password:\n\n%s\n\nThe link expires in %s. If you did not ask for it, ignore this email.",
+			user.Name, link, h.Config.Auth.PasswordResetTTL.Duration,
+		),
+	})
+	if err != nil {
+		log.Printf("Error sending email to %s: %s", user.Email, err)
+	}
+}
+
+// ResetPassword sets a new password with a reset token and ends every session
+// of the user
+func (h *Handler) ResetPassword(c *gin.Context) {
+	var request struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
+	}
+	if request.Token == "" {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": "please provide the token"})
+		return
+	}
+	if request.Password == "" {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": "please provide the password"})
+		return
+	}
+
+	// The policy is checked before consuming the token, so the link can be
+	// used again with a better password
+	ctx := c.Request.Context()
+	tokenHash := utils.HashToken(request.Token)
+	token, err := h.UserTokens.GetUserToken(ctx, database.TokenPurposePasswordReset, tokenHash)
+	if errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": "invalid or expired token"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+	user, err := h.Users.GetUserByID(ctx, token.UserID)
+	if errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": "invalid or expired token"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+	if !h.checkPasswordPolicy(c, request.Password, user.Email, user.Name) {
+		return
+	}
+
+	token, err = h.UserTokens.ConsumeUserToken(ctx, database.TokenPurposePasswordReset, tokenHash)
+	if errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": "invalid or expired token"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+
+	hashedPassword, err := h.Passwords.Hash(request.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "Could not hash password"})
+		return
+	}
+
+	err = h.Users.UpdatePassword(ctx, token.UserID, hashedPassword)
+	if errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": "invalid or expired token"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+
+	// Sessions opened with the old password must not survive the reset
+	if err := h.endUserSessions(ctx, token.UserID, ""); err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+
+	// The owner proved access to the email, the failed attempts no longer count
+	if err := h.Lockout.Unlock(ctx, user.ID, user.Email); err != nil {
+		log.Printf("Error unlocking user %d: %s", user.ID, err)
+	}
+
+	c.JSON(http.StatusOK, map[string]any{"message": "password has been reset", "status": "success"})
+}
+
+// sendMail delivers message in the background, so the response time does not
+// tell whether an email was sent
+func (h *Handler) sendMail(message mailer.Message) {
+	h.runInBackground(func(ctx context.Context) {
+		if err := h.Mailer.Send(ctx, message); err != nil {
+			log.Printf("Error sending email to %s: %s", message.To, err)
+		}
+	})
+}
+
+// runInBackground runs work after the response with its own deadline, Wait
+// blocks until it is done
+func (h *Handler) runInBackground(work func(ctx context.Context)) {
+	h.background.Add(1)
+	go func() {
+		defer h.background.Done()
+
+		ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+		defer cancel()
+		work(ctx)
+	}()
+}
+
+// Wait blocks until the work started in the background, like the emails, is
+// done or ctx is. The server calls it once the requests are drained, before
+// closing the database.
+func (h *Handler) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		h.background.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// rehashPassword replaces a hash made with an outdated algorithm or parameters,
+// the login goes on when it fails
+func (h *Handler) rehashPassword(ctx context.Context, user *database.User, password string) {
+	hashedPassword, err := h.Passwords.Hash(password)
+	if err == nil {
+		err = h.Users.UpdatePassword(ctx, user.ID, hashedPassword)
+	}
+	if err != nil {
+		log.Printf("Error rehashing the password of user %d: %s", user.ID, err)
+	}
+}
+
+// checkPasswordPolicy writes a 400 response listing the violations unless the
+// password of the account with email and name follows the policy
+func (h *Handler) checkPasswordPolicy(c *gin.Context, password, email, name string) bool {
+	violations := h.PasswordPolicy.Check(password, email, name)
+	if len(violations) == 0 {
+		return true
+	}
+	c.JSON(http.StatusBadRequest, map[string]any{
+		"error":      "password does not meet the policy",
+		"violations": violations,
+	})
+	return false
+}
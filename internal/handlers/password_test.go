@@ -0,0 +1,102 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/0xSumeet/go_api/internal/configs"
+	"github.com/0xSumeet/go_api/internal/database"
+)
+
+func TestForgotPassword(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("ada@example.com")
+	s.createUser("bob@example.com")
+
+	// An unknown email gets the same answer
+	known := s.do(http.MethodPost, "/password/forgot", "", map[string]any{"email": "Ada@example.com"})
+	unknown := s.do(http.MethodPost, "/password/forgot", "", map[string]any{"email": "eve@example.com"})
+	if known.Code != http.StatusOK || known.Body.String() != unknown.Body.String() {
+		t.Fatalf("got %d %s for an account and %d %s for none", known.Code, known.Body, unknown.Code, unknown.Body)
+	}
+	token := linkToken(t, s.mail("ada@example.com", "/password/reset"), "/password/reset")
+
+	// A second request within the interval sends nothing
+	s.expect(s.do(http.MethodPost, "/password/forgot", "", map[string]any{"email": "ada@example.com"}), http.StatusOK)
+	s.expect(s.do(http.MethodPost, "/password/forgot", "", map[string]any{"email": "bob@example.com"}), http.StatusOK)
+	s.mail("bob@example.com", "/password/reset")
+	if sent := len(s.mails("ada@example.com", "/password/reset")); sent != 1 {
+		t.Errorf("got %d reset emails to ada, want 1", sent)
+	}
+
+	s.expect(s.do(http.MethodPost, "/password/reset", "", map[string]any{"token": token, "password": "a brand new battery staple"}), http.StatusOK)
+	s.expect(s.do(http.MethodPost, "/login", "", map[string]any{"email": "ada@example.com", "password": "a brand new battery staple"}), http.StatusOK)
+}
+
+func TestForgotPasswordIPLimit(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) { cfg.Auth.PasswordResetIPLimit = 2 })
+
+	for _, email := range []string{"a@example.com", "b@example.com"} {
+		s.expect(s.do(http.MethodPost, "/password/forgot", "", map[string]any{"email": email}), http.StatusOK)
+	}
+	w := s.do(http.MethodPost, "/password/forgot", "", map[string]any{"email": "c@example.com"})
+	s.expect(w, http.StatusTooManyRequests)
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("no Retry-After header")
+	}
+}
+
+// violations returns the codes of a password policy refusal
+func violations(t *testing.T, body map[string]any) []string {
+	t.Helper()
+	if body["error"] != "password does not meet the policy" {
+		t.Fatalf("got %v, want a policy refusal", body)
+	}
+	var codes []string
+	for _, violation := range body["violations"].([]any) {
+		codes = append(codes, violation.(map[string]any)["code"].(string))
+	}
+	return codes
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	s := newTestServer(t)
+	signUp := func(password string) *httptest.ResponseRecorder {
+		return s.do(http.MethodPost, "/signup", "", map[string]any{
+			"email":    "ada@example.com",
+			"name":     "Ada Lovelace",
+			"password": password,
+		})
+	}
+
+	body := s.expect(signUp("short"), http.StatusBadRequest)
+	if got := violations(t, body); !slices.Equal(got, []string{"too_short"}) {
+		t.Errorf("signup with a short password: got %v", got)
+	}
+	body = s.expect(signUp("lovelace forever"), http.StatusBadRequest)
+	if got := violations(t, body); !slices.Equal(got, []string{"contains_user_info"}) {
+		t.Errorf("signup with the name: got %v", got)
+	}
+	if _, err := s.h.Users.GetUserByEmail(context.Background(), "ada@example.com"); !errors.Is(err, database.ErrNotFound) {
+		t.Fatalf("a refused signup created the account: %v", err)
+	}
+	s.createUser("ada@example.com")
+
+	s.expect(s.do(http.MethodPost, "/password/forgot", "", map[string]any{"email": "ada@example.com"}), http.StatusOK)
+	token := linkToken(t, s.mail("ada@example.com", "/password/reset"), "/password/reset")
+	reset := func(password string) *httptest.ResponseRecorder {
+		return s.do(http.MethodPost, "/password/reset", "", map[string]any{"token": token, "password": password})
+	}
+
+	body = s.expect(reset("ada@example.com!"), http.StatusBadRequest)
+	if got := violations(t, body); !slices.Equal(got, []string{"contains_user_info"}) {
+		t.Errorf("reset with the email: got %v", got)
+	}
+	// The link is kept for a password meeting the policy
+	s.expect(reset("a brand new battery staple"), http.StatusOK)
+	s.expect(reset("another battery staple"), http.StatusBadRequest)
+}
@@ -0,0 +1,515 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/0xSumeet/go_api/internal/database"
+	"github.com/0xSumeet/go_api/internal/patch"
+
+	"github.com/gin-gonic/gin"
+)
+
+// productID reads the id parameter, it writes the error response when it
+// returns false
+func productID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": "Invalid product ID"})
+		return 0, false
+	}
+	return id, true
+}
+
+// productListParams are the query parameters of the product listing
+var productListParams = map[string]bool{
+	"page": true, "limit": true, "cursor": true, "sort": true,
+	"category": true, "min_price": true, "max_price": true, "in_stock": true, "name_contains": true,
+	"created_after": true, "created_before": true, "updated_after": true, "updated_before": true,
+}
+
+// productQuery reads the filters and the sort of the product listing
+func productQuery(c *gin.Context) (database.ProductQuery, error) {
+	var query database.ProductQuery
+	for name := range c.Request.URL.Query() {
+		if !productListParams[name] {
+			return query, fmt.Errorf("unknown query parameter %q", name)
+		}
+	}
+
+	filter := &query.Filter
+	if category, ok := c.GetQuery("category"); ok {
+		filter.Category = &category
+	}
+	var err error
+	if filter.MinPrice, err = queryPrice(c, "min_price"); err != nil {
+		return query, err
+	}
+	if filter.MaxPrice, err = queryPrice(c, "max_price"); err != nil {
+		return query, err
+	}
+	if filter.MinPrice != nil && filter.MaxPrice != nil && *filter.MinPrice > *filter.MaxPrice {
+		return query, fmt.Errorf("min_price cannot be above max_price")
+	}
+	if value := c.Query("in_stock"); value != "" {
+		inStock, err := strconv.ParseBool(value)
+		if err != nil {
+			return query, fmt.Errorf("in_stock must be true or false")
+		}
+		filter.InStock = &inStock
+	}
+	filter.NameContains = strings.TrimSpace(c.Query("name_contains"))
+	for name, field := range map[string]**time.Time{
+		"created_after":  &filter.CreatedAfter,
+		"created_before": &filter.CreatedBefore,
+		"updated_after":  &filter.UpdatedAfter,
+		"updated_before": &filter.UpdatedBefore,
+	} {
+		if *field, err = queryTime(c, name); err != nil {
+			return query, err
+		}
+	}
+
+	if value := c.Query("sort"); value != "" {
+		if query.Sort, err = database.ParseProductSort(value); err != nil {
+			return query, err
+		}
+	}
+	return query, nil
+}
+
+func queryPrice(c *gin.Context, name string) (*float64, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	price, err := strconv.ParseFloat(value, 64)
+	if err != nil || price < 0 || price >= maxPrice {
+		return nil, fmt.Errorf("%s must be a price between 0 and %.0f", name, float64(maxPrice))
+	}
+	return &price, nil
+}
+
+// queryTime parses an RFC 3339 time or a date, which is midnight UTC
+func queryTime(c *gin.Context, name string) (*time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("%s must be a date (2006-01-02) or an RFC 3339 time", name)
+}
+
+// productCursor is a position in the keyset pagination of the product listing
+type productCursor struct {
+	// Listing is the fingerprint of the filter and the sort of the listing
+	Listing string `json:"l"`
+	// Before lists the products before Key instead of after it
+	Before bool                `json:"b,omitempty"`
+	Key    database.ProductKey `json:"k"`
+}
+
+// listingFingerprint identifies the filter and the sort of a listing, a
+// cursor only applies to the listing it was made for
+func listingFingerprint(query database.ProductQuery) string {
+	data, _ := json.Marshal([]any{query.Filter, query.Sort})
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+// listProductsByCursor returns the products after or before the position of
+// the cursor parameter, from the first one when it is empty. Unlike the
+// pages, the products added or removed meanwhile never shift the next ones.
+func (h *Handler) listProductsByCursor(c *gin.Context, query database.ProductQuery, limit int) {
+	listing := listingFingerprint(query)
+	if value := c.Query("cursor"); value != "" {
+		var position productCursor
+		if err := h.Cursors.Decode(value, &position); err != nil || position.Listing != listing {
+			c.JSON(http.StatusBadRequest, map[string]any{"error": "invalid cursor, it must come from a listing with the same filters and sort"})
+			return
+		}
+		if position.Before {
+			query.Before = &position.Key
+		} else {
+			query.After = &position.Key
+		}
+	}
+
+	// The product after the page tells whether there is a next one
+	products, err := h.Products.ListProducts(c.Request.Context(), query, limit+1)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "Cannot paginate data"})
+		return
+	}
+	if products == nil {
+		products = []database.Product{}
+	}
+	more := len(products) > limit
+	if more && query.Before != nil {
+		products = products[1:]
+	} else if more {
+		products = products[:limit]
+	}
+
+	links := []string{h.productsLink(c, "", "first")}
+	var next, prev any
+	if len(products) > 0 {
+		if more || query.Before != nil {
+			cursor, err := h.Cursors.Encode(productCursor{Listing: listing, Key: query.KeyOf(products[len(products)-1])})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, map[string]any{"error": err.Error()})
+				return
+			}
+			next = cursor
+			links = append(links, h.productsLink(c, cursor, "next"))
+		}
+		if query.After != nil || (more && query.Before != nil) {
+			cursor, err := h.Cursors.Encode(productCursor{Listing: listing, Before: true, Key: query.KeyOf(products[0])})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, map[string]any{"error": err.Error()})
+				return
+			}
+			prev = cursor
+			links = append(links, h.productsLink(c, cursor, "prev"))
+		}
+	}
+
+	c.Header("Link", strings.Join(links, ", "))
+	c.JSON(http.StatusOK, map[string]any{"data": products, "next_cursor": next, "prev_cursor": prev})
+}
+
+// productsLink returns an RFC 8288 link to the listing of the request at
+// another cursor
+func (h *Handler) productsLink(c *gin.Context, cursor, rel string) string {
+	query := c.Request.URL.Query()
+	query.Set("cursor", cursor)
+	return fmt.Sprintf("<%s%s?%s>; rel=%q", strings.TrimRight(h.Config.PublicURL, "/"), c.Request.URL.Path, query.Encode(), rel)
+}
+
+// productETag is the strong entity tag of a product version
+func productETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// matchETag reports whether an If-Match or If-None-Match header lists etag.
+// The weak comparison of If-None-Match ignores the W/ prefix, the strong one
+// of If-Match never matches a weak tag.
+func matchETag(header, etag string, weak bool) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if strings.HasPrefix(tag, "W/") {
+			if !weak {
+				continue
+			}
+			tag = tag[2:]
+		}
+		if tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatch returns the If-Match header of a product write, it writes 428 and
+// returns false when the header is missing but required
+func (h *Handler) ifMatch(c *gin.Context) (string, bool) {
+	header := c.GetHeader("If-Match")
+	if header == "" && h.Config.Products.RequireIfMatch {
+		c.JSON(http.StatusPreconditionRequired, map[string]any{"error": "the If-Match header is required"})
+		return "", false
+	}
+	return header, true
+}
+
+// writeVersion returns the product version a PUT or DELETE applies to, 0 for
+// any when If-Match is missing or *. It writes the error response when it
+// returns false.
+func (h *Handler) writeVersion(c *gin.Context, id int) (int, bool) {
+	header, ok := h.ifMatch(c)
+	if !ok || header == "" || strings.TrimSpace(header) == "*" {
+		return 0, ok
+	}
+
+	current, err := h.Products.GetProductByID(c.Request.Context(), id)
+	if errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusNotFound, map[string]any{"error": "product not found"})
+		return 0, false
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"message": "error getting product", "error": err.Error()})
+		return 0, false
+	}
+	if !matchETag(header, productETag(current.Version), false) {
+		preconditionFailed(c)
+		return 0, false
+	}
+	return current.Version, true
+}
+
+func preconditionFailed(c *gin.Context) {
+	c.JSON(http.StatusPreconditionFailed, map[string]any{"error": "the product was modified, get it again"})
+}
+
+// maxPatchSize limits the patch documents, a product is a few hundred bytes
+const maxPatchSize = 64 << 10
+
+// maxPrice is the largest price the NUMERIC(12, 2) column holds
+const maxPrice = 1e10
+
+// PatchProduct applies a JSON Merge Patch or a JSON Patch to a product. Unlike
+// UpdateProduct, a field set to 0 or "" is updated, and a removed field is
+// reset to its default when it has one. Only the changed fields are written.
+func (h *Handler) PatchProduct(c *gin.Context) {
+	id, ok := productID(c)
+	if !ok {
+		return
+	}
+	ifMatch, ok := h.ifMatch(c)
+	if !ok {
+		return
+	}
+
+	apply := patch.MergePatch
+	switch c.ContentType() {
+	case patch.MergePatchType:
+	case patch.JSONPatchType:
+		apply = patch.JSONPatch
+	default:
+		c.Header("Accept-Patch", patch.MergePatchType+", "+patch.JSONPatchType)
+		c.JSON(http.StatusUnsupportedMediaType, map[string]any{
+			"error": fmt.Sprintf("the patch must be %s or %s", patch.MergePatchType, patch.JSONPatchType),
+		})
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxPatchSize+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": "could not read the patch"})
+		return
+	} else if len(body) > maxPatchSize {
+		c.JSON(http.StatusRequestEntityTooLarge, map[string]any{"error": "the patch is too large"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	current, err := h.Products.GetProductByID(ctx, id)
+	if errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusNotFound, map[string]any{"error": "product not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"message": "error getting product", "error": err.Error()})
+		return
+	}
+	if ifMatch != "" && !matchETag(ifMatch, productETag(current.Version), false) {
+		preconditionFailed(c)
+		return
+	}
+
+	doc, err := json.Marshal(current)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": err.Error()})
+		return
+	}
+	patched, err := apply(doc, body)
+	if errors.Is(err, patch.ErrInvalidPatch) {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
+	} else if errors.Is(err, patch.ErrCannotApply) {
+		c.JSON(http.StatusConflict, map[string]any{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": err.Error()})
+		return
+	}
+
+	changes, err := productChanges(current, patched)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, map[string]any{"status": "failure", "error": err.Error()})
+		return
+	}
+
+	// The patch was applied to current, it is only written if nothing changed since
+	updated, err := h.Products.PatchProduct(ctx, id, current.Version, changes)
+	if errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusNotFound, map[string]any{"error": "product not found"})
+		return
+	} else if errors.Is(err, database.ErrVersionMismatch) {
+		if ifMatch != "" {
+			preconditionFailed(c)
+			return
+		}
+		c.JSON(http.StatusConflict, map[string]any{"error": "the product was modified while patching it, try again"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"message": "Could not update product", "error": err.Error()})
+		return
+	}
+
+	c.Header("ETag", productETag(updated.Version))
+	c.JSON(http.StatusOK, map[string]any{"message": "success", "data": updated})
+}
+
+// productChanges validates the patched product and returns the fields that
+// differ from current. Absent and null fields take their column default, the
+// name and the price have none.
+func productChanges(current database.Product, patched []byte) (database.ProductChanges, error) {
+	var product struct {
+		ID            *int     `json:"id"`
+		ProductName   *string  `json:"product_name"`
+		Category      *string  `json:"category"`
+		StockQuantity *int     `json:"stock_quantity"`
+		Price         *float64 `json:"price"`
+	}
+	if !bytes.HasPrefix(patched, []byte("{")) {
+		return database.ProductChanges{}, fmt.Errorf("error: the patched product must be an object")
+	}
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&product); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			expected := "a string"
+			switch typeErr.Type.Kind() {
+			case reflect.Int:
+				expected = "an integer"
+			case reflect.Float64:
+				expected = "a number"
+			}
+			return database.ProductChanges{}, fmt.Errorf("error: %s must be %s", typeErr.Field, expected)
+		}
+		return database.ProductChanges{}, fmt.Errorf("error: the patched product is invalid: %v", strings.TrimPrefix(err.Error(), "json: "))
+	}
+
+	if product.ID != nil && *product.ID != current.ID {
+		return database.ProductChanges{}, fmt.Errorf("error: the product id cannot be changed")
+	}
+	if product.ProductName == nil || strings.TrimSpace(*product.ProductName) == "" {
+		return database.ProductChanges{}, fmt.Errorf("error: product name cannot be empty")
+	}
+	if product.Price == nil {
+		return database.ProductChanges{}, fmt.Errorf("error: price cannot be removed")
+	}
+	if *product.Price < 0 || *product.Price >= maxPrice {
+		return database.ProductChanges{}, fmt.Errorf("error: price must be between 0 and %.0f", float64(maxPrice))
+	}
+	if product.Category == nil {
+		product.Category = new(string)
+	}
+	if product.StockQuantity == nil {
+		product.StockQuantity = new(int)
+	}
+	if *product.StockQuantity < 0 {
+		return database.ProductChanges{}, fmt.Errorf("error: stock quantity cannot be negative value")
+	}
+
+	var changes database.ProductChanges
+	if *product.ProductName != current.ProductName {
+		changes.ProductName = product.ProductName
+	}
+	if *product.Category != current.Category {
+		changes.Category = product.Category
+	}
+	if *product.StockQuantity != current.StockQuantity {
+		changes.StockQuantity = product.StockQuantity
+	}
+	if *product.Price != current.Price {
+		changes.Price = product.Price
+	}
+	return changes, nil
+}
+
+// DeleteProduct moves a product to the trash, an admin can restore it until
+// it is purged
+func (h *Handler) DeleteProduct(c *gin.Context) {
+	id, ok := productID(c)
+	if !ok {
+		return
+	}
+
+	version, ok := h.writeVersion(c, id)
+	if !ok {
+		return
+	}
+
+	err := h.Products.DeleteProduct(c.Request.Context(), id, version)
+	if errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusNotFound, map[string]any{"error": "product not found"})
+		return
+	} else if errors.Is(err, database.ErrVersionMismatch) {
+		preconditionFailed(c)
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"message": "Could not delete product", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, map[string]any{"message": "product deleted", "status": "success"})
+}
+
+// GetDeletedProducts lists the products in the trash
+func (h *Handler) GetDeletedProducts(c *gin.Context) {
+	products, err := h.Products.GetDeletedProducts(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"message": "error getting products", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, map[string]any{"products": products})
+}
+
+// RestoreProduct takes a deleted product out of the trash
+func (h *Handler) RestoreProduct(c *gin.Context) {
+	id, ok := productID(c)
+	if !ok {
+		return
+	}
+
+	product, err := h.Products.RestoreProduct(c.Request.Context(), id)
+	if errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusNotFound, map[string]any{"error": "deleted product not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"message": "Could not restore product", "error": err.Error()})
+		return
+	}
+	c.Header("ETag", productETag(product.Version))
+	c.JSON(http.StatusOK, map[string]any{"message": "success", "data": product})
+}
+
+// PurgeProduct removes a deleted product for good, products must be deleted
+// first so a live one is never purged by mistake
+func (h *Handler) PurgeProduct(c *gin.Context) {
+	id, ok := productID(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	err := h.Products.PurgeProduct(ctx, id)
+	if errors.Is(err, database.ErrNotFound) {
+		if _, err := h.Products.GetProductByID(ctx, id); err == nil {
+			c.JSON(http.StatusConflict, map[string]any{"error": "delete the product before purging it"})
+			return
+		}
+		c.JSON(http.StatusNotFound, map[string]any{"error": "deleted product not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"message": "Could not purge product", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, map[string]any{"message": "product purged", "status": "success"})
+}
@@ -0,0 +1,356 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/0xSumeet/go_api/internal/configs"
+)
+
+// catalog returns a server with a catalog manager and the token of the manager
+func catalog(t *testing.T, configure ...func(cfg *config.Config)) (*testServer, string) {
+	t.Helper()
+	s := newTestServer(t, configure...)
+	s.createUser("manager@example.com", "catalog_manager")
+	return s, s.token("manager@example.com")
+}
+
+// addProduct creates a product and returns its id
+func (s *testServer) addProduct(token, name, category string, stock int, price float64) int {
+	s.t.Helper()
+	body := s.expect(s.do(http.MethodPost, "/register-product", token, map[string]any{
+		"product_name":   name,
+		"category":       category,
+		"stock_quantity": stock,
+		"price":          price,
+	}), http.StatusOK)
+	return int(body["data"].(map[string]any)["id"].(float64))
+}
+
+// listIDs returns the ids of a page of the product listing and its total count
+func (s *testServer) listIDs(token, query string) ([]int, string) {
+	s.t.Helper()
+	w := s.do(http.MethodGet, "/secure/products?"+query, token, nil)
+	if w.Code != http.StatusOK {
+		s.t.Fatalf("listing %q: got status %d: %s", query, w.Code, w.Body.String())
+	}
+	var products []struct {
+		ID int `json:"id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &products); err != nil {
+		s.t.Fatalf("decoding the listing %q: %v", w.Body.String(), err)
+	}
+	ids := make([]int, len(products))
+	for i, product := range products {
+		ids[i] = product.ID
+	}
+	return ids, w.Header().Get("X-Total-Count")
+}
+
+func TestPatchProduct(t *testing.T) {
+	s, token := catalog(t)
+	id := s.addProduct(token, "Lamp", "home", 3, 20)
+	path := "/products/" + strconv.Itoa(id)
+
+	patch := func(contentType, body string) map[string]any {
+		w := s.do(http.MethodPatch, path, token, body, "Content-Type", contentType)
+		return map[string]any{"status": w.Code, "body": decode(t, w)}
+	}
+
+	tests := []struct {
+		name, contentType, body string
+		status                  int
+		want                    map[string]any
+	}{
+		{"merge", "application/merge-patch+json", `{"price":25,"category":"office"}`, http.StatusOK, map[string]any{"price": 25.0, "category": "office"}},
+		{"merge resets a removed field", "application/merge-patch+json", `{"category":null}`, http.StatusOK, map[string]any{"category": ""}},
+		{"merge sets zero", "application/merge-patch+json", `{"stock_quantity":0}`, http.StatusOK, map[string]any{"stock_quantity": 0.0}},
+		{"json patch", "application/json-patch+json", `[{"op":"test","path":"/price","value":25},{"op":"replace","path":"/product_name","value":"Desk lamp"}]`, http.StatusOK, map[string]any{"product_name": "Desk lamp"}},
+		{"json patch copy", "application/json-patch+json", `[{"op":"copy","from":"/product_name","path":"/category"}]`, http.StatusOK, map[string]any{"category": "Desk lamp"}},
+		{"failed test", "application/json-patch+json", `[{"op":"test","path":"/price","value":1},{"op":"replace","path":"/price","value":2}]`, http.StatusConflict, nil},
+		{"missing path", "application/json-patch+json", `[{"op":"replace","path":"/nothing/here","value":1}]`, http.StatusConflict, nil},
+		{"invalid patch", "application/json-patch+json", `{"op":"replace"}`, http.StatusBadRequest, nil},
+		{"unknown op", "application/json-patch+json", `[{"op":"move"}]`, http.StatusBadRequest, nil},
+		{"unknown field", "application/merge-patch+json", `{"color":"red"}`, http.StatusUnprocessableEntity, nil},
+		{"wrong type", "application/merge-patch+json", `{"price":"free"}`, http.StatusUnprocessableEntity, nil},
+		{"removed name", "application/json-patch+json", `[{"op":"remove","path":"/product_name"}]`, http.StatusUnprocessableEntity, nil},
+		{"changed id", "application/merge-patch+json", `{"id":1000}`, http.StatusUnprocessableEntity, nil},
+		{"negative stock", "application/merge-patch+json", `{"stock_quantity":-1}`, http.StatusUnprocessableEntity, nil},
+		{"other media type", "application/json", `{"price":1}`, http.StatusUnsupportedMediaType, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := patch(test.contentType, test.body)
+			if got["status"] != test.status {
+				t.Fatalf("got %v, want status %d", got, test.status)
+			}
+			data, _ := got["body"].(map[string]any)["data"].(map[string]any)
+			for field, value := range test.want {
+				if data[field] != value {
+					t.Errorf("got %s %v, want %v", field, data[field], value)
+				}
+			}
+		})
+	}
+
+	s.expect(s.do(http.MethodPatch, "/products/1000", token, `{"price":1}`, "Content-Type", "application/merge-patch+json"), http.StatusNotFound)
+}
+
+func TestProductETag(t *testing.T) {
+	s, token := catalog(t)
+	id := s.addProduct(token, "Lamp", "home", 3, 20)
+	path := "/products/" + strconv.Itoa(id)
+	get := "/secure/product/" + strconv.Itoa(id)
+
+	w := s.do(http.MethodGet, get, token, nil)
+	s.expect(w, http.StatusOK)
+	etag := w.Header().Get("ETag")
+	if etag != `"1"` {
+		t.Fatalf("got ETag %q, want \"1\"", etag)
+	}
+
+	// If-None-Match compares weakly
+	for _, header := range []string{etag, "W/" + etag, `"9", ` + etag, "*"} {
+		if w := s.do(http.MethodGet, get, token, nil, "If-None-Match", header); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+			t.Errorf("If-None-Match %s: got status %d, want 304 without body", header, w.Code)
+		}
+	}
+	s.expect(s.do(http.MethodGet, get, token, nil, "If-None-Match", `"2"`), http.StatusOK)
+
+	merge := func(ifMatch, body string) *httptest.ResponseRecorder {
+		return s.do(http.MethodPatch, path, token, body, "Content-Type", "application/merge-patch+json", "If-Match", ifMatch)
+	}
+	// If-Match compares strongly
+	s.expect(merge("W/"+etag, `{"price":21}`), http.StatusPreconditionFailed)
+	w = merge(etag, `{"price":21}`)
+	s.expect(w, http.StatusOK)
+	if got := w.Header().Get("ETag"); got != `"2"` {
+		t.Errorf("got ETag %q after the patch, want \"2\"", got)
+	}
+	// The client that read the first version is refused
+	s.expect(merge(etag, `{"price":22}`), http.StatusPreconditionFailed)
+
+	update := map[string]any{"product_name": "Lamp", "category": "home", "stock_quantity": 2, "price": 30}
+	s.expect(s.do(http.MethodPut, "/update-product/"+strconv.Itoa(id), token, update, "If-Match", etag), http.StatusPreconditionFailed)
+	s.expect(s.do(http.MethodPut, "/update-product/"+strconv.Itoa(id), token, update, "If-Match", `"2"`), http.StatusOK)
+
+	s.expect(s.do(http.MethodDelete, path, token, nil, "If-Match", `"2"`), http.StatusPreconditionFailed)
+	s.expect(s.do(http.MethodDelete, path, token, nil, "If-Match", `"3"`), http.StatusOK)
+}
+
+func TestRequireIfMatch(t *testing.T) {
+	s, token := catalog(t, func(cfg *config.Config) { cfg.Products.RequireIfMatch = true })
+	id := s.addProduct(token, "Lamp", "home", 3, 20)
+	path := "/products/" + strconv.Itoa(id)
+
+	s.expect(s.do(http.MethodPatch, path, token, `{"price":21}`, "Content-Type", "application/merge-patch+json"), http.StatusPreconditionRequired)
+	s.expect(s.do(http.MethodDelete, path, token, nil), http.StatusPreconditionRequired)
+	s.expect(s.do(http.MethodDelete, path, token, nil, "If-Match", "*"), http.StatusOK)
+}
+
+func TestListProducts(t *testing.T) {
+	s, token := catalog(t)
+	lamp := s.addProduct(token, "Lamp", "home", 3, 20)
+	desk := s.addProduct(token, "Desk", "office", 1, 120)
+	chair := s.addProduct(token, "Chair", "office", 5, 60)
+	wool := s.addProduct(token, "100% wool", "home", 2, 30)
+	cap := s.addProduct(token, "Cap_x", "hats", 4, 10)
+	s.expect(s.do(http.MethodPatch, "/products/"+strconv.Itoa(desk), token, `{"stock_quantity":0}`, "Content-Type", "application/merge-patch+json"), http.StatusOK)
+
+	tests := []struct {
+		query string
+		want  []int
+		total int
+	}{
+		{"", []int{lamp, desk, chair, wool, cap}, 5},
+		{"limit=2&page=2", []int{chair, wool}, 5},
+		{"category=office", []int{desk, chair}, 2},
+		{"min_price=20&max_price=60", []int{lamp, chair, wool}, 3},
+		{"in_stock=false", []int{desk}, 1},
+		{"in_stock=true&sort=-stock_quantity", []int{chair, cap, lamp, wool}, 4},
+		{"name_contains=LAMP", []int{lamp}, 1},
+		{"name_contains=%25", []int{wool}, 1},
+		{"name_contains=_", []int{cap}, 1},
+		{"sort=price", []int{cap, lamp, wool, chair, desk}, 5},
+		{"sort=category,-price", []int{cap, wool, lamp, desk, chair}, 5},
+		{"sort=product_name&limit=2", []int{wool, cap}, 5},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			ids, total := s.listIDs(token, test.query)
+			if !slices.Equal(ids, test.want) {
+				t.Errorf("got products %v, want %v", ids, test.want)
+			}
+			if total != strconv.Itoa(test.total) {
+				t.Errorf("got X-Total-Count %s, want %d", total, test.total)
+			}
+		})
+	}
+
+	for _, query := range []string{"sort=color", "sort=price,-price", "min_price=cheap", "min_price=-1", "in_stock=maybe", "created_after=yesterday", "page=0", "limit=many"} {
+		t.Run(query, func(t *testing.T) {
+			s.expect(s.do(http.MethodGet, "/secure/products?"+query, token, nil), http.StatusBadRequest)
+		})
+	}
+}
+
+func TestListProductsEmpty(t *testing.T) {
+	s, token := catalog(t)
+
+	// An empty catalog, no match and a page past the end are all empty listings
+	for _, query := range []string{"", "category=none", "cursor="} {
+		t.Run(query, func(t *testing.T) {
+			w := s.do(http.MethodGet, "/secure/products?"+query, token, nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("got status %d: %s", w.Code, w.Body.String())
+			}
+			if body := w.Body.String(); body != "[]" && !strings.HasPrefix(body, `{"data":[]`) {
+				t.Errorf("got %s, want no products", body)
+			}
+			if query != "cursor=" && w.Header().Get("X-Total-Count") != "0" {
+				t.Errorf("got X-Total-Count %q, want 0", w.Header().Get("X-Total-Count"))
+			}
+		})
+	}
+
+	s.addProduct(token, "Lamp", "home", 3, 20)
+	if ids, total := s.listIDs(token, "page=2"); len(ids) != 0 || total != "1" {
+		t.Errorf("got products %v and X-Total-Count %s past the end, want none of 1", ids, total)
+	}
+}
+
+func TestListProductsByCursor(t *testing.T) {
+	s, token := catalog(t)
+	for i := 0; i < 11; i++ {
+		s.addProduct(token, fmt.Sprint("item", i%4), []string{"a", "b"}[i%2], i%3, float64(5+i%5))
+	}
+
+	type page struct {
+		Data []struct {
+			ID int `json:"id"`
+		} `json:"data"`
+		Next *string `json:"next_cursor"`
+		Prev *string `json:"prev_cursor"`
+	}
+	list := func(query, cursor string) page {
+		w := s.do(http.MethodGet, "/secure/products?"+query+"&limit=3&cursor="+url.QueryEscape(cursor), token, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("listing %q: got status %d: %s", query, w.Code, w.Body.String())
+		}
+		var p page
+		if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	ids := func(p page) []int {
+		var ids []int
+		for _, product := range p.Data {
+			ids = append(ids, product.ID)
+		}
+		return ids
+	}
+
+	// Walking the cursors both ways lists the products in the order of the pages
+	for _, query := range []string{"", "sort=-price,product_name", "sort=category,-stock_quantity,price", "sort=-id", "category=a&sort=price", "name_contains=item&sort=-product_name"} {
+		t.Run(query, func(t *testing.T) {
+			want, _ := s.listIDs(token, query+"&limit=20")
+
+			var forward []int
+			p := list(query, "")
+			for {
+				forward = append(forward, ids(p)...)
+				if p.Next == nil {
+					break
+				}
+				p = list(query, *p.Next)
+			}
+			if !slices.Equal(forward, want) {
+				t.Fatalf("got %v forward, want %v", forward, want)
+			}
+
+			backward := ids(p)
+			for p.Prev != nil {
+				p = list(query, *p.Prev)
+				backward = append(ids(p), backward...)
+			}
+			if !slices.Equal(backward, want) {
+				t.Errorf("got %v backward, want %v", backward, want)
+			}
+		})
+	}
+
+	first := list("sort=-price", "")
+	if first.Prev != nil || first.Next == nil {
+		t.Fatalf("got cursors %v and %v on the first page", first.Prev, first.Next)
+	}
+	next := *first.Next
+
+	// A product added before the cursor does not shift the next page
+	second := ids(list("sort=-price", next))
+	s.addProduct(token, "top", "a", 1, 1000)
+	if got := ids(list("sort=-price", next)); !slices.Equal(got, second) {
+		t.Errorf("got %v after an insert, want %v", got, second)
+	}
+
+	for name, query := range map[string]string{
+		"other sort":   "sort=price&cursor=" + next,
+		"other filter": "sort=-price&category=a&cursor=" + next,
+		"tampered":     "sort=-price&cursor=" + next[:len(next)-2] + "xx",
+		"garbage":      "cursor=garbage",
+		"with page":    "page=2&cursor=",
+	} {
+		t.Run(name, func(t *testing.T) {
+			s.expect(s.do(http.MethodGet, "/secure/products?"+query, token, nil), http.StatusBadRequest)
+		})
+	}
+}
+
+func TestDeleteProduct(t *testing.T) {
+	s, token := catalog(t)
+	s.createUser("admin@example.com", "admin")
+	admin := s.token("admin@example.com")
+	lamp := s.addProduct(token, "Lamp", "home", 3, 20)
+	chair := s.addProduct(token, "Chair", "home", 1, 50)
+	get := "/secure/product/" + strconv.Itoa(lamp)
+	restore := "/admin/products/" + strconv.Itoa(lamp) + "/restore"
+	purge := "/admin/products/" + strconv.Itoa(lamp)
+
+	// Only a deleted product can be restored or purged
+	s.expect(s.do(http.MethodPost, restore, admin, nil), http.StatusNotFound)
+	s.expect(s.do(http.MethodDelete, purge, admin, nil), http.StatusConflict)
+
+	s.expect(s.do(http.MethodDelete, "/products/"+strconv.Itoa(lamp), token, nil), http.StatusOK)
+	s.expect(s.do(http.MethodGet, get, token, nil), http.StatusNotFound)
+	if ids, total := s.listIDs(token, ""); !slices.Equal(ids, []int{chair}) || total != "1" {
+		t.Errorf("listed %v of %s after the delete, want the chair alone", ids, total)
+	}
+	s.expect(s.do(http.MethodDelete, "/products/"+strconv.Itoa(lamp), token, nil), http.StatusNotFound)
+	s.expect(s.do(http.MethodGet, "/admin/products/deleted", token, nil), http.StatusForbidden)
+	deleted := s.expect(s.do(http.MethodGet, "/admin/products/deleted", admin, nil), http.StatusOK)["products"].([]any)
+	if len(deleted) != 1 || deleted[0].(map[string]any)["deleted_at"] == nil {
+		t.Fatalf("got deleted products %v, want the lamp", deleted)
+	}
+
+	s.expect(s.do(http.MethodPost, restore, admin, nil), http.StatusOK)
+	s.expect(s.do(http.MethodGet, get, token, nil), http.StatusOK)
+	if ids, _ := s.listIDs(token, ""); !slices.Equal(ids, []int{lamp, chair}) {
+		t.Errorf("listed %v after the restore, want both products", ids)
+	}
+
+	s.expect(s.do(http.MethodDelete, "/products/"+strconv.Itoa(lamp), token, nil), http.StatusOK)
+	s.expect(s.do(http.MethodDelete, purge, admin, nil), http.StatusOK)
+	s.expect(s.do(http.MethodDelete, purge, admin, nil), http.StatusNotFound)
+	s.expect(s.do(http.MethodPost, restore, admin, nil), http.StatusNotFound)
+	deleted = s.expect(s.do(http.MethodGet, "/admin/products/deleted", admin, nil), http.StatusOK)["products"].([]any)
+	if len(deleted) != 0 {
+		t.Errorf("got deleted products %v after the purge", deleted)
+	}
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/mail"
+	"time"
+
+	"github.com/0xSumeet/go_api/internal/database"
+	"github.com/0xSumeet/go_api/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// currentUser loads the user of the token subject, it writes the error
+// response when it returns false
+func (h *Handler) currentUser(c *gin.Context) (*database.User, bool) {
+	user, err := auth.CurrentUser(c, h.Users)
+	if errors.Is(err, database.ErrNotFound) {
+		// The account was deleted after the token was issued
+		c.JSON(http.StatusUnauthorized, map[string]any{"error": "not authenticated"})
+		return nil, false
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return nil, false
+	}
+	return user, true
+}
+
+// GetMe returns the profile of the authenticated user
+func (h *Handler) GetMe(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, newUserResponse(user))
+}
+
+// UpdateMe changes the name, email or password of the authenticated user. The
+// email and password need the current password, a new email is verified again
+// and a new password ends the other sessions.
+func (h *Handler) UpdateMe(c *gin.Context) {
+	var request struct {
+		Name            string `json:"name"`
+		Email           string `json:"email"`
+		Password        string `json:"password"`
+		CurrentPassword string `json:"current_password"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	emailChanged := request.Email != "" && request.Email != user.Email
+	if emailChanged {
+		if _, err := mail.ParseAddress(request.Email); err != nil {
+			c.JSON(http.StatusBadRequest, map[string]any{"error": "invalid email address"})
+			return
+		}
+	}
+
+	if emailChanged || request.Password != "" {
+		if request.CurrentPassword == "" {
+			c.JSON(http.StatusBadRequest, map[string]any{"error": "please provide the current password"})
+			return
+		}
+		if ok, _, err := h.Passwords.Verify(user.Password, request.CurrentPassword); err != nil || !ok {
+			c.JSON(http.StatusForbidden, map[string]any{"error": "current password is incorrect"})
+			return
+		}
+	}
+
+	if request.Password != "" {
+		email, name := user.Email, user.Name
+		if emailChanged {
+			email = request.Email
+		}
+		if request.Name != "" {
+			name = request.Name
+		}
+		if !h.checkPasswordPolicy(c, request.Password, email, name) {
+			return
+		}
+	}
+
+	update := &database.User{ID: user.ID, Name: request.Name}
+	if emailChanged {
+		update.Email = request.Email
+	}
+	if request.Password != "" {
+		hashedPassword, err := h.Passwords.Hash(request.Password)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, map[string]any{"error": "Could not hash password"})
+			return
+		}
+		update.Password = hashedPassword
+	}
+
+	ctx := c.Request.Context()
+	updated, err := h.Users.UpdateUser(ctx, update)
+	if errors.Is(err, database.ErrEmailExists) {
+		c.JSON(http.StatusConflict, map[string]any{"error": err.Error()})
+		return
+	} else if errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusUnauthorized, map[string]any{"error": "not authenticated"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": err.Error()})
+		return
+	}
+
+	if request.Password != "" {
+		if err := h.endUserSessions(ctx, user.ID, currentSessionID(c)); err != nil {
+			c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+			return
+		}
+	}
+	if emailChanged {
+		if err := h.sendVerificationEmail(ctx, updated); err != nil {
+			log.Printf("Error sending the verification email of user %d: %s", updated.ID, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, map[string]any{"message": newUserResponse(updated), "status": "success"})
+}
+
+// DeleteMe deletes the account of the authenticated user, it needs the password
+func (h *Handler) DeleteMe(c *gin.Context) {
+	var request struct {
+		Password string `json:"password"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil || request.Password == "" {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": "please provide the password"})
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if ok, _, err := h.Passwords.Verify(user.Password, request.Password); err != nil || !ok {
+		c.JSON(http.StatusForbidden, map[string]any{"error": "password is incorrect"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.Users.DeleteUser(ctx, user.ID); err != nil && !errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": err.Error()})
+		return
+	}
+
+	// The refresh tokens are gone with the account, the access token is revoked
+	if claims, ok := auth.GetClaims(c); ok {
+		if err := h.RevokedTokens.RevokeToken(ctx, claims.Id, time.Unix(claims.ExpiresAt, 0)); err != nil {
+			log.Printf("Error revoking the token of deleted user %d: %s", user.ID, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, map[string]any{"message": "account deleted", "status": "success"})
+}
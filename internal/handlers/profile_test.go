@@ -0,0 +1,81 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUpdateMe(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("ada@example.com")
+	s.createUser("bob@example.com")
+	token := s.token("ada@example.com")
+	update := func(body map[string]any) *httptest.ResponseRecorder {
+		return s.do(http.MethodPatch, "/secure/me", token, body)
+	}
+
+	// The name needs no password
+	body := s.expect(update(map[string]any{"name": "Ada Lovelace"}), http.StatusOK)
+	if body["message"].(map[string]any)["name"] != "Ada Lovelace" {
+		t.Errorf("got %v", body)
+	}
+
+	s.expect(update(map[string]any{"email": "lovelace@example.com"}), http.StatusBadRequest)
+	s.expect(update(map[string]any{"email": "lovelace@example.com", "current_password": "wrong password"}), http.StatusForbidden)
+	s.expect(update(map[string]any{"email": "not an email", "current_password": testPassword}), http.StatusBadRequest)
+	s.expect(update(map[string]any{"email": "bob@example.com", "current_password": testPassword}), http.StatusConflict)
+
+	// A new email is verified again
+	s.expect(update(map[string]any{"email": "lovelace@example.com", "current_password": testPassword}), http.StatusOK)
+	me := s.me(token)
+	if me["email"] != "lovelace@example.com" || me["email_verified"] != false {
+		t.Fatalf("got %v after the email change, want the new email not verified", me)
+	}
+	verify := linkToken(t, s.mail("lovelace@example.com", "/verify-email"), "/verify-email")
+	s.expect(s.do(http.MethodGet, "/verify-email?token="+verify, "", nil), http.StatusOK)
+	if me := s.me(token); me["email_verified"] != true {
+		t.Errorf("got %v after the verification", me)
+	}
+	s.expect(s.do(http.MethodPost, "/login", "", map[string]any{"email": "ada@example.com", "password": testPassword}), http.StatusUnauthorized)
+}
+
+func TestUpdateMePassword(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("ada@example.com")
+	other := s.login("ada@example.com")
+	token := s.token("ada@example.com")
+	update := func(body map[string]any) *httptest.ResponseRecorder {
+		return s.do(http.MethodPatch, "/secure/me", token, body)
+	}
+
+	s.expect(update(map[string]any{"password": "a brand new battery staple"}), http.StatusBadRequest)
+	s.expect(update(map[string]any{"password": "a brand new battery staple", "current_password": "wrong password"}), http.StatusForbidden)
+	s.expect(update(map[string]any{"password": "short", "current_password": testPassword}), http.StatusBadRequest)
+	s.expect(update(map[string]any{"password": "a brand new battery staple", "current_password": testPassword}), http.StatusOK)
+
+	// The other sessions end, the current one goes on
+	s.me(token)
+	s.expect(s.do(http.MethodGet, "/secure/me", other["token"].(string), nil), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodPost, "/token/refresh", "", map[string]any{"refresh_token": other["refresh_token"]}), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodPost, "/login", "", map[string]any{"email": "ada@example.com", "password": testPassword}), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodPost, "/login", "", map[string]any{"email": "ada@example.com", "password": "a brand new battery staple"}), http.StatusOK)
+}
+
+func TestDeleteMe(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("ada@example.com")
+	login := s.login("ada@example.com")
+	token := login["token"].(string)
+
+	s.expect(s.do(http.MethodDelete, "/secure/me", token, map[string]any{}), http.StatusBadRequest)
+	s.expect(s.do(http.MethodDelete, "/secure/me", token, map[string]any{"password": "wrong password"}), http.StatusForbidden)
+	s.expect(s.do(http.MethodDelete, "/secure/me", token, map[string]any{"password": testPassword}), http.StatusOK)
+
+	s.expect(s.do(http.MethodGet, "/secure/me", token, nil), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodPost, "/token/refresh", "", map[string]any{"refresh_token": login["refresh_token"]}), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodPost, "/login", "", map[string]any{"email": "ada@example.com", "password": testPassword}), http.StatusUnauthorized)
+
+	// The email can be used again
+	s.createUser("ada@example.com")
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/0xSumeet/go_api/internal/database"
+	"github.com/0xSumeet/go_api/internal/rbac"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetUserRoles returns the roles and resulting permissions of a user
+func (h *Handler) GetUserRoles(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": "Invalid user id"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if _, err := h.Users.GetUserByID(ctx, userID); errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusNotFound, map[string]any{"error": "user not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+
+	roles, err := h.Roles.GetUserRoles(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]any{
+		"user_id":     userID,
+		"roles":       roles,
+		"permissions": rbac.Permissions(roles),
+	})
+}
+
+// GrantRole grants the role of the request body to a user
+func (h *Handler) GrantRole(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": "Invalid user id"})
+		return
+	}
+
+	var request struct {
+		Role string `json:"role"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
+	}
+	if !rbac.IsValidRole(request.Role) {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": "unknown role " + request.Role})
+		return
+	}
+
+	err = h.Roles.GrantRole(c.Request.Context(), userID, request.Role)
+	if errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusNotFound, map[string]any{"error": "user not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": err.Error()})
+		return
+	}
+
+	h.GetUserRoles(c)
+}
+
+// RevokeRole removes a role from a user, the change applies to its next token
+func (h *Handler) RevokeRole(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": "Invalid user id"})
+		return
+	}
+
+	role := c.Param("role")
+	if !rbac.IsValidRole(role) {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": "unknown role " + role})
+		return
+	}
+
+	if err := h.Roles.RevokeRole(c.Request.Context(), userID, role); err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": err.Error()})
+		return
+	}
+
+	h.GetUserRoles(c)
+}
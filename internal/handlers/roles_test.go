@@ -0,0 +1,90 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+var testProduct = map[string]any{"product_name": "Lamp", "category": "home", "stock_quantity": 3, "price": 20}
+
+func TestPermissions(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("customer@example.com")
+	s.createUser("manager@example.com", "catalog_manager")
+	s.createUser("admin@example.com", "admin")
+	customer := s.token("customer@example.com")
+	manager := s.token("manager@example.com")
+	admin := s.token("admin@example.com")
+
+	s.expect(s.do(http.MethodGet, "/secure/products", "", nil), http.StatusUnauthorized)
+
+	tests := []struct {
+		name, method, path, token string
+		body                      any
+		status                    int
+	}{
+		{"customer writes", http.MethodPost, "/register-product", customer, testProduct, http.StatusForbidden},
+		{"manager writes", http.MethodPost, "/register-product", manager, testProduct, http.StatusOK},
+		{"customer reads", http.MethodGet, "/secure/product/1", customer, nil, http.StatusOK},
+		{"manager restores", http.MethodPost, "/admin/products/1/restore", manager, nil, http.StatusForbidden},
+		{"manager grants", http.MethodPost, "/admin/users/1/roles", manager, map[string]any{"role": "admin"}, http.StatusForbidden},
+		{"admin writes", http.MethodPost, "/register-product", admin, testProduct, http.StatusOK},
+		{"admin lists the trash", http.MethodGet, "/admin/products/deleted", admin, nil, http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if w := s.do(test.method, test.path, test.token, test.body); w.Code != test.status {
+				t.Errorf("got status %d, want %d: %s", w.Code, test.status, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestGrantRole(t *testing.T) {
+	s := newTestServer(t)
+	userID := s.createUser("ada@example.com")
+	s.createUser("admin@example.com", "admin")
+	admin := s.token("admin@example.com")
+	path := "/admin/users/" + strconv.Itoa(userID) + "/roles"
+
+	// Roles are read when the token is issued
+	before := s.token("ada@example.com")
+	s.expect(s.do(http.MethodPost, "/register-product", before, testProduct), http.StatusForbidden)
+
+	s.expect(s.do(http.MethodPost, path, admin, map[string]any{"role": "unknown"}), http.StatusBadRequest)
+	granted := s.expect(s.do(http.MethodPost, path, admin, map[string]any{"role": "catalog_manager"}), http.StatusOK)
+	if roles := stringList(granted["roles"]); len(roles) != 2 {
+		t.Errorf("got roles %v, want customer and catalog_manager", roles)
+	}
+
+	after := s.token("ada@example.com")
+	s.expect(s.do(http.MethodPost, "/register-product", after, testProduct), http.StatusOK)
+
+	s.expect(s.do(http.MethodDelete, path+"/catalog_manager", admin, nil), http.StatusOK)
+	revoked := s.token("ada@example.com")
+	s.expect(s.do(http.MethodPost, "/register-product", revoked, testProduct), http.StatusForbidden)
+}
+
+func TestWritesNeedVerifiedEmail(t *testing.T) {
+	s := newTestServer(t)
+	s.expect(s.do(http.MethodPost, "/signup", "", map[string]any{
+		"email":    "ada@example.com",
+		"name":     "Ada",
+		"password": testPassword,
+	}), http.StatusCreated)
+	user, err := s.h.Users.GetUserByEmail(context.Background(), "ada@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.h.Roles.GrantRole(context.Background(), user.ID, "catalog_manager"); err != nil {
+		t.Fatal(err)
+	}
+
+	token := s.token("ada@example.com")
+	body := s.expect(s.do(http.MethodPost, "/register-product", token, testProduct), http.StatusForbidden)
+	if body["error"] != "email address not verified" {
+		t.Errorf("got %v, want the email to be verified first", body)
+	}
+}
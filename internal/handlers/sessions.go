@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/0xSumeet/go_api/internal/database"
+	"github.com/0xSumeet/go_api/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+type sessionResponse struct {
+	database.Session
+	// Current marks the session of the request
+	Current bool `json:"current"`
+}
+
+// currentSessionID returns the session of the access token, empty for tokens
+// issued before sessions
+func currentSessionID(c *gin.Context) string {
+	if claims, ok := auth.GetClaims(c); ok {
+		return claims.SessionID
+	}
+	return ""
+}
+
+// endSession revokes a session and its refresh tokens, the auth middleware then
+// refuses its access tokens
+func (h *Handler) endSession(ctx context.Context, sessionID string) error {
+	if err := h.Sessions.RevokeSession(ctx, sessionID); err != nil {
+		return err
+	}
+	return h.RefreshTokens.RevokeRefreshTokenFamily(ctx, sessionID)
+}
+
+// endUserSessions revokes every session of a user but exceptID, and all its
+// refresh tokens when exceptID is empty
+func (h *Handler) endUserSessions(ctx context.Context, userID int, exceptID string) error {
+	ids, err := h.Sessions.RevokeUserSessions(ctx, userID, exceptID)
+	if err != nil {
+		return err
+	}
+	if exceptID == "" {
+		return h.RefreshTokens.RevokeUserRefreshTokens(ctx, userID)
+	}
+	for _, id := range ids {
+		if err := h.RefreshTokens.RevokeRefreshTokenFamily(ctx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListSessions returns the active sessions of the authenticated user
+func (h *Handler) ListSessions(c *gin.Context) {
+	userID, ok := auth.CurrentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, map[string]any{"error": "not authenticated"})
+		return
+	}
+
+	sessions, err := h.Sessions.ListUserSessions(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+
+	current := currentSessionID(c)
+	response := make([]sessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, sessionResponse{Session: session, Current: session.ID == current})
+	}
+	c.JSON(http.StatusOK, map[string]any{"sessions": response})
+}
+
+// RevokeSession ends a session of the authenticated user, like a lost device
+func (h *Handler) RevokeSession(c *gin.Context) {
+	userID, ok := auth.CurrentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, map[string]any{"error": "not authenticated"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	session, err := h.Sessions.GetSession(ctx, c.Param("id"))
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+	if err != nil || session.UserID != userID {
+		c.JSON(http.StatusNotFound, map[string]any{"error": "session not found"})
+		return
+	}
+
+	if err := h.endSession(ctx, session.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "could not revoke session"})
+		return
+	}
+	c.JSON(http.StatusOK, map[string]any{"message": "session revoked", "status": "success"})
+}
+
+// RevokeOtherSessions ends every session of the authenticated user but the
+// current one
+func (h *Handler) RevokeOtherSessions(c *gin.Context) {
+	userID, ok := auth.CurrentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, map[string]any{"error": "not authenticated"})
+		return
+	}
+
+	current := currentSessionID(c)
+	if current == "" {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": "log in again to manage your sessions"})
+		return
+	}
+
+	if err := h.endUserSessions(c.Request.Context(), userID, current); err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "could not revoke sessions"})
+		return
+	}
+	c.JSON(http.StatusOK, map[string]any{"message": "other sessions revoked", "status": "success"})
+}
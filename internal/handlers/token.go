@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/0xSumeet/go_api/internal/database"
+	"github.com/0xSumeet/go_api/internal/middleware"
+	"github.com/0xSumeet/go_api/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type tokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	// ExpiresIn is the lifetime of the access token in seconds
+	ExpiresIn int
+	// WithheldRoles are the roles left out of the token until 2FA is enabled
+	WithheldRoles []string
+}
+
+// issueTokens returns a new access token and a refresh token. Without a
+// sessionID it opens a session for a login proven with the amr methods, else
+// it rotates the tokens of the session, which keeps the methods of its login.
+// The session id is also the family of the refresh tokens.
+func (h *Handler) issueTokens(c *gin.Context, user *database.User, sessionID string, amr []string) (*tokenPair, error) {
+	ctx := c.Request.Context()
+
+	refreshExpiresAt := time.Now().Add(h.Config.Auth.RefreshTokenTTL.Duration)
+	if sessionID == "" {
+		var err error
+		sessionID, err = utils.GenerateRandomString(16)
+		if err != nil {
+			return nil, err
+		}
+		err = h.Sessions.CreateSession(ctx, &database.Session{
+			ID:        sessionID,
+			UserID:    user.ID,
+			UserAgent: c.Request.UserAgent(),
+			IP:        c.ClientIP(),
+			ExpiresAt: refreshExpiresAt,
+			AMR:       amr,
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		session, err := h.Sessions.GetSession(ctx, sessionID)
+		if err != nil {
+			return nil, err
+		}
+		amr = session.AMR
+		if err := h.Sessions.TouchSession(ctx, sessionID, refreshExpiresAt); err != nil {
+			return nil, err
+		}
+	}
+
+	// Roles are read on every issue, so granted or revoked roles apply on refresh
+	roles, err := h.Roles.GetUserRoles(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The roles requiring 2FA need a session that logged in with it, enabling
+	// 2FA later does not upgrade the session
+	var withheld []string
+	if !slices.Contains(amr, utils.AMROTP) {
+		roles, withheld = h.splitTwoFactorRoles(roles)
+	}
+
+	accessTTL := h.Config.Auth.AccessTokenTTL.Duration
+	claims := utils.Claims{
+		Roles:         roles,
+		EmailVerified: user.EmailVerified(),
+		AMR:           amr,
+		SessionID:     sessionID,
+	}
+	claims.Issuer = h.Config.TokenIssuer()
+	claims.Audience = h.Config.Auth.Audience
+	accessToken, err := utils.GenerateJWT(h.Keys, user.ID, claims, accessTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, refreshHash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	err = h.RefreshTokens.CreateRefreshToken(ctx, &database.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  sessionID,
+		TokenHash: refreshHash,
+		ExpiresAt: refreshExpiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &tokenPair{
+		AccessToken:   accessToken,
+		RefreshToken:  refreshToken,
+		ExpiresIn:     int(accessTTL.Seconds()),
+		WithheldRoles: withheld,
+	}, nil
+}
+
+// RefreshToken exchanges a refresh token for a new token pair. Refresh tokens
+// are single use: presenting a used one revokes every token of its family.
+func (h *Handler) RefreshToken(c *gin.Context) {
+	var request struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil || request.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": "please provide the refresh token"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	stored, err := h.RefreshTokens.GetRefreshTokenByHash(ctx, utils.HashToken(request.RefreshToken))
+	if errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusUnauthorized, map[string]any{"error": "invalid refresh token"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+
+	if stored.RevokedAt != nil || time.Now().After(stored.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, map[string]any{"error": "refresh token expired or revoked"})
+		return
+	}
+
+	// A refresh token used twice was stolen, revoke the whole family
+	used := false
+	if stored.UsedAt == nil {
+		used, err = h.RefreshTokens.MarkRefreshTokenUsed(ctx, stored.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+			return
+		}
+	}
+	if !used {
+		if err := h.endSession(ctx, stored.FamilyID); err != nil {
+			c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, map[string]any{"error": "refresh token reuse detected"})
+		return
+	}
+
+	user, err := h.Users.GetUserByID(ctx, stored.UserID)
+	if errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusUnauthorized, map[string]any{"error": "invalid refresh token"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+
+	tokens, err := h.issueTokens(c, user, stored.FamilyID, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to generate JWT token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+		"status":        "success",
+	})
+}
+
+// Logout revokes the access token of the request and ends its session, and the
+// session of the refresh token when given
+func (h *Handler) Logout(c *gin.Context) {
+	var request struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	// The body is optional
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
+	}
+
+	claims, ok := auth.GetClaims(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, map[string]any{"error": "not authenticated"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	err := h.RevokedTokens.RevokeToken(ctx, claims.Id, time.Unix(claims.ExpiresAt, 0))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "could not revoke token"})
+		return
+	}
+	if claims.SessionID != "" {
+		if err := h.endSession(ctx, claims.SessionID); err != nil {
+			c.JSON(http.StatusInternalServerError, map[string]any{"error": "could not revoke token"})
+			return
+		}
+	}
+
+	if request.RefreshToken != "" {
+		stored, err := h.RefreshTokens.GetRefreshTokenByHash(ctx, utils.HashToken(request.RefreshToken))
+		if err != nil && !errors.Is(err, database.ErrNotFound) {
+			c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+			return
+		}
+		// Only the owner of the refresh token can revoke it
+		if userID, _ := auth.CurrentUserID(c); err == nil && stored.UserID == userID {
+			if err := h.endSession(ctx, stored.FamilyID); err != nil {
+				c.JSON(http.StatusInternalServerError, map[string]any{"error": "could not revoke token"})
+				return
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, map[string]any{"message": "Successfully logged out", "status": "success"})
+}
+
+// JWKS publishes the public keys verifying the access tokens
+func (h *Handler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.Keys.JWKS())
+}
@@ -0,0 +1,165 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/0xSumeet/go_api/internal/configs"
+	"github.com/0xSumeet/go_api/pkg/utils"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestRefreshTokenRotation(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("ada@example.com")
+	first := s.login("ada@example.com")["refresh_token"].(string)
+
+	refresh := func(token string) *httptest.ResponseRecorder {
+		return s.do(http.MethodPost, "/token/refresh", "", map[string]any{"refresh_token": token})
+	}
+
+	rotated := s.expect(refresh(first), http.StatusOK)
+	second := rotated["refresh_token"].(string)
+	if second == "" || second == first {
+		t.Fatalf("the refresh token was not rotated: %v", rotated)
+	}
+	access := rotated["token"].(string)
+	s.expect(s.do(http.MethodGet, "/secure/me", access, nil), http.StatusOK)
+
+	// Presenting the used token again ends the session of its family
+	body := s.expect(refresh(first), http.StatusUnauthorized)
+	if body["error"] != "refresh token reuse detected" {
+		t.Errorf("reusing a refresh token: got %v", body)
+	}
+	s.expect(refresh(second), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodGet, "/secure/me", access, nil), http.StatusUnauthorized)
+}
+
+func TestRefreshTokenInvalid(t *testing.T) {
+	s := newTestServer(t)
+
+	s.expect(s.do(http.MethodPost, "/token/refresh", "", map[string]any{}), http.StatusBadRequest)
+	s.expect(s.do(http.MethodPost, "/token/refresh", "", map[string]any{"refresh_token": "unknown"}), http.StatusUnauthorized)
+}
+
+func TestLogoutEndsSession(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("ada@example.com")
+	login := s.login("ada@example.com")
+	access, refresh := login["token"].(string), login["refresh_token"].(string)
+
+	s.expect(s.do(http.MethodPost, "/logout", access, nil), http.StatusOK)
+	s.expect(s.do(http.MethodGet, "/secure/me", access, nil), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodPost, "/token/refresh", "", map[string]any{"refresh_token": refresh}), http.StatusUnauthorized)
+}
+
+func TestExpiredSessionEndsTokens(t *testing.T) {
+	// The session ends with its refresh token, long before the access token
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Auth.RefreshTokenTTL = config.Duration{Duration: time.Nanosecond}
+	})
+	s.createUser("ada@example.com")
+	access := s.token("ada@example.com")
+
+	body := s.expect(s.do(http.MethodGet, "/secure/me", access, nil), http.StatusUnauthorized)
+	if body["error"] != "Session has ended" {
+		t.Errorf("got %v", body)
+	}
+}
+
+func TestLoginMethods(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("ada@example.com")
+	amr := func(token string) []string {
+		return stringList(claims(t, token)["amr"])
+	}
+
+	login := s.login("ada@example.com")
+	if got := amr(login["token"].(string)); !slices.Equal(got, []string{utils.AMRPassword}) {
+		t.Errorf("got amr %v for a password login, want pwd", got)
+	}
+
+	s.expect(s.do(http.MethodPost, "/login/magic", "", map[string]any{"email": "ada@example.com"}), http.StatusOK)
+	token := linkToken(t, s.mail("ada@example.com", "/login/magic"), "/login/magic")
+	magic := s.expect(s.do(http.MethodPost, "/login/magic/redeem", "", map[string]any{"token": token}), http.StatusOK)
+	if got := amr(magic["token"].(string)); !slices.Equal(got, []string{utils.AMRMagicLink}) {
+		t.Errorf("got amr %v for a magic link, want email", got)
+	}
+
+	// A refreshed token keeps the method of the login
+	refreshed := s.expect(s.do(http.MethodPost, "/token/refresh", "", map[string]any{"refresh_token": magic["refresh_token"]}), http.StatusOK)
+	if got := amr(refreshed["token"].(string)); !slices.Equal(got, []string{utils.AMRMagicLink}) {
+		t.Errorf("got amr %v after the refresh, want email", got)
+	}
+}
+
+func TestAccessTokenClaims(t *testing.T) {
+	s := newTestServer(t)
+	userID := s.createUser("ada@example.com")
+	token := s.token("ada@example.com")
+
+	values := claims(t, token)
+	if values["sub"] != strconv.Itoa(userID) {
+		t.Errorf("got sub %v, want the user id %d", values["sub"], userID)
+	}
+	if values["iss"] != s.cfg.TokenIssuer() || values["aud"] != s.cfg.Auth.Audience {
+		t.Errorf("got iss %v and aud %v", values["iss"], values["aud"])
+	}
+	for _, claim := range []string{"iat", "nbf", "exp", "jti"} {
+		if values[claim] == nil {
+			t.Errorf("no %s claim", claim)
+		}
+	}
+	if me := s.me(token); me["id"] != float64(userID) || me["email"] != "ada@example.com" {
+		t.Errorf("got %v, want the user of the subject", me)
+	}
+
+	sign := func(userID int, change func(*utils.Claims)) string {
+		t.Helper()
+		values := utils.Claims{StandardClaims: jwt.StandardClaims{Issuer: s.cfg.TokenIssuer(), Audience: s.cfg.Auth.Audience}}
+		token, err := utils.GenerateJWT(s.h.Keys, userID, values, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if change == nil {
+			return token
+		}
+		// Signed again with the changed claims
+		parsed, err := utils.ParseJWT(s.h.Keys, token, s.cfg.TokenIssuer(), s.cfg.Auth.Audience)
+		if err != nil {
+			t.Fatal(err)
+		}
+		change(parsed)
+		if token, err = s.h.Keys.Sign(parsed); err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	s.me(sign(userID, nil))
+
+	tests := []struct {
+		name   string
+		change func(*utils.Claims)
+	}{
+		{"other issuer", func(c *utils.Claims) { c.Issuer = "https://evil.example.com" }},
+		{"other audience", func(c *utils.Claims) { c.Audience = "other-api" }},
+		{"no jti", func(c *utils.Claims) { c.Id = "" }},
+		{"no iat", func(c *utils.Claims) { c.IssuedAt = 0 }},
+		{"not yet valid", func(c *utils.Claims) { c.NotBefore = time.Now().Add(time.Hour).Unix() }},
+		{"expired", func(c *utils.Claims) { c.ExpiresAt = time.Now().Add(-time.Hour).Unix() }},
+		{"name as subject", func(c *utils.Claims) { c.Subject = "ada" }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s.expect(s.do(http.MethodGet, "/secure/me", sign(userID, test.change), nil), http.StatusUnauthorized)
+		})
+	}
+
+	// A subject without account is not authenticated
+	s.expect(s.do(http.MethodGet, "/secure/me", sign(userID+100, nil), nil), http.StatusUnauthorized)
+}
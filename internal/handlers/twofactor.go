@@ -0,0 +1,402 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/0xSumeet/go_api/internal/database"
+	"github.com/0xSumeet/go_api/internal/middleware"
+	"github.com/0xSumeet/go_api/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recoveryCodeCount is the number of recovery codes generated at once
+const recoveryCodeCount = 10
+
+// twoFactorEnabled reports whether the user confirmed a TOTP secret
+func (h *Handler) twoFactorEnabled(ctx context.Context, userID int) (bool, error) {
+	totp, err := h.TwoFactor.GetTOTP(ctx, userID)
+	if errors.Is(err, database.ErrNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return totp.Enabled(), nil
+}
+
+// splitTwoFactorRoles separates the roles requiring 2FA from the others
+func (h *Handler) splitTwoFactorRoles(roles []string) (allowed, withheld []string) {
+	allowed = []string{}
+	for _, role := range roles {
+		if h.requiresTwoFactor(role) {
+			withheld = append(withheld, role)
+		} else {
+			allowed = append(allowed, role)
+		}
+	}
+	return allowed, withheld
+}
+
+func (h *Handler) requiresTwoFactor(role string) bool {
+	for _, enforced := range h.Config.Auth.TwoFactorRoles {
+		if enforced == role {
+			return true
+		}
+	}
+	return false
+}
+
+// verifySecondFactor accepts a TOTP code or, when code is empty, an unused
+// recovery code. Each code is accepted only once.
+func (h *Handler) verifySecondFactor(ctx context.Context, totp *database.TOTP, code, recoveryCode string) (bool, error) {
+	if code != "" {
+		step, ok := utils.ValidateTOTP(totp.Secret, code, h.Now())
+		if !ok {
+			return false, nil
+		}
+		return h.TwoFactor.UseTOTPStep(ctx, totp.UserID, step)
+	}
+	if recoveryCode != "" {
+		hash := utils.HashToken(utils.NormalizeRecoveryCode(recoveryCode))
+		return h.TwoFactor.UseRecoveryCode(ctx, totp.UserID, hash)
+	}
+	return false, nil
+}
+
+// newRecoveryCodes replaces the recovery codes of the user and returns them in clear
+func (h *Handler) newRecoveryCodes(ctx context.Context, userID int) ([]string, error) {
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = utils.HashToken(utils.NormalizeRecoveryCode(code))
+	}
+	if err := h.TwoFactor.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// startTwoFactorChallenge answers a valid first factor, the method amr value,
+// of a user with 2FA enabled with a short-lived challenge token to send with
+// the code to /login/2fa
+func (h *Handler) startTwoFactorChallenge(c *gin.Context, user *database.User, method string) {
+	token, tokenHash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "could not generate token"})
+		return
+	}
+
+	ttl := h.Config.Auth.TwoFactorChallengeTTL.Duration
+	err = h.UserTokens.CreateUserToken(c.Request.Context(), &database.UserToken{
+		UserID:      user.ID,
+		Purpose:     database.TokenPurposeLoginChallenge,
+		TokenHash:   tokenHash,
+		ExpiresAt:   time.Now().Add(ttl),
+		LoginMethod: method,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]any{
+		"message":         "two-factor authentication required",
+		"challenge_token": token,
+		"expires_in":      int(ttl.Seconds()),
+		"status":          "two_factor_required",
+	})
+}
+
+// LoginTwoFactor exchanges a login challenge token and a TOTP or recovery code
+// for the token pair
+func (h *Handler) LoginTwoFactor(c *gin.Context) {
+	var request struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
+	}
+	if request.ChallengeToken == "" {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": "please provide the challenge token"})
+		return
+	}
+	if request.Code == "" && request.RecoveryCode == "" {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": "please provide the code or a recovery code"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	challengeHash := utils.HashToken(request.ChallengeToken)
+	// The challenge is only consumed by a valid code, so a typo can be retried
+	challenge, err := h.UserTokens.GetUserToken(ctx, database.TokenPurposeLoginChallenge, challengeHash)
+	if errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusUnauthorized, map[string]any{"error": "invalid or expired challenge"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+
+	user, err := h.Users.GetUserByID(ctx, challenge.UserID)
+	if errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusUnauthorized, map[string]any{"error": "invalid or expired challenge"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+
+	// Wrong codes count as failed logins of the account
+	if !h.checkLockout(c, user.Email) {
+		return
+	}
+
+	totp, err := h.TwoFactor.GetTOTP(ctx, challenge.UserID)
+	if errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusUnauthorized, map[string]any{"error": "invalid or expired challenge"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+
+	valid, err := h.verifySecondFactor(ctx, totp, request.Code, request.RecoveryCode)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+	if !valid {
+		h.recordLoginFailure(c, &user.ID, user.Email)
+		c.JSON(http.StatusUnauthorized, map[string]any{"error": "invalid code"})
+		return
+	}
+
+	if _, err := h.UserTokens.ConsumeUserToken(ctx, database.TokenPurposeLoginChallenge, challengeHash); errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusUnauthorized, map[string]any{"error": "invalid or expired challenge"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+
+	method := challenge.LoginMethod
+	if method == "" {
+		method = utils.AMRPassword
+	}
+	tokens, err := h.issueTokens(c, user, "", []string{method, utils.AMROTP})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to generate JWT token"})
+		return
+	}
+
+	if err := h.Lockout.Succeed(ctx, user.ID, user.Email, c.ClientIP()); err != nil {
+		log.Printf("Error recording the login of user %d: %s", user.ID, err)
+	}
+
+	c.JSON(http.StatusOK, loginResponse(tokens))
+}
+
+// SetupTOTP generates a new TOTP secret for the user, 2FA is only enabled once
+// a code of the authenticator app is confirmed
+func (h *Handler) SetupTOTP(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	userID := user.ID
+
+	ctx := c.Request.Context()
+	enabled, err := h.twoFactorEnabled(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+	if enabled {
+		c.JSON(http.StatusConflict, map[string]any{"error": "two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "could not generate secret"})
+		return
+	}
+	if err := h.TwoFactor.SaveTOTP(ctx, userID, secret); err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]any{
+		"secret":      secret,
+		"otpauth_uri": utils.TOTPURI(h.Config.Auth.TOTPIssuer, user.Email, secret),
+		"status":      "success",
+	})
+}
+
+// ConfirmTOTP enables 2FA with a first code of the authenticator app and
+// returns the recovery codes, they are only shown once
+func (h *Handler) ConfirmTOTP(c *gin.Context) {
+	var request struct {
+		Code string `json:"code"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil || request.Code == "" {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": "please provide the code"})
+		return
+	}
+
+	userID, ok := auth.CurrentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, map[string]any{"error": "not authenticated"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	totp, err := h.TwoFactor.GetTOTP(ctx, userID)
+	if errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusNotFound, map[string]any{"error": "two-factor authentication is not set up"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+	if totp.Enabled() {
+		c.JSON(http.StatusConflict, map[string]any{"error": "two-factor authentication is already enabled"})
+		return
+	}
+
+	valid, err := h.verifySecondFactor(ctx, totp, request.Code, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+	if !valid {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": "invalid code"})
+		return
+	}
+
+	codes, err := h.newRecoveryCodes(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "could not generate recovery codes"})
+		return
+	}
+	if err := h.TwoFactor.ConfirmTOTP(ctx, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+
+	// The sessions opened with the password alone, maybe by someone who knows
+	// it, end with 2FA. This one keeps its roles until the next login.
+	if err := h.endUserSessions(ctx, userID, currentSessionID(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "could not revoke sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]any{
+		"message":        "two-factor authentication enabled, log in again to use it",
+		"recovery_codes": codes,
+		"status":         "success",
+	})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes, it needs a current code
+func (h *Handler) RegenerateRecoveryCodes(c *gin.Context) {
+	totp, ok := h.checkSecondFactor(c)
+	if !ok {
+		return
+	}
+
+	codes, err := h.newRecoveryCodes(c.Request.Context(), totp.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "could not generate recovery codes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]any{"recovery_codes": codes, "status": "success"})
+}
+
+// DisableTOTP turns 2FA off, it needs a current code and is refused to the
+// users holding a role that requires 2FA
+func (h *Handler) DisableTOTP(c *gin.Context) {
+	userID, ok := auth.CurrentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, map[string]any{"error": "not authenticated"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	roles, err := h.Roles.GetUserRoles(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+	if _, withheld := h.splitTwoFactorRoles(roles); len(withheld) > 0 {
+		c.JSON(http.StatusForbidden, map[string]any{"error": "two-factor authentication is required for role " + withheld[0]})
+		return
+	}
+
+	totp, ok := h.checkSecondFactor(c)
+	if !ok {
+		return
+	}
+
+	if err := h.TwoFactor.DeleteTOTP(ctx, totp.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]any{"message": "two-factor authentication disabled", "status": "success"})
+}
+
+// checkSecondFactor reads a code or recovery code from the body and checks it
+// against the enabled TOTP of the authenticated user, it writes the error
+// response when it returns false
+func (h *Handler) checkSecondFactor(c *gin.Context) (*database.TOTP, bool) {
+	var request struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil || (request.Code == "" && request.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": "please provide the code or a recovery code"})
+		return nil, false
+	}
+
+	userID, ok := auth.CurrentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, map[string]any{"error": "not authenticated"})
+		return nil, false
+	}
+
+	ctx := c.Request.Context()
+	totp, err := h.TwoFactor.GetTOTP(ctx, userID)
+	if errors.Is(err, database.ErrNotFound) || (err == nil && !totp.Enabled()) {
+		c.JSON(http.StatusNotFound, map[string]any{"error": "two-factor authentication is not enabled"})
+		return nil, false
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return nil, false
+	}
+
+	valid, err := h.verifySecondFactor(ctx, totp, request.Code, request.RecoveryCode)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return nil, false
+	}
+	if !valid {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": "invalid code"})
+		return nil, false
+	}
+	return totp, true
+}
@@ -0,0 +1,125 @@
+package handlers_test
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/0xSumeet/go_api/internal/configs"
+	"github.com/0xSumeet/go_api/pkg/utils"
+)
+
+// totpCodes returns the codes of the previous, current and next steps, the
+// three codes accepted at testNow
+func totpCodes(t *testing.T, secret string) []string {
+	t.Helper()
+	var codes []string
+	for _, at := range []time.Time{testNow.Add(-30 * time.Second), testNow, testNow.Add(30 * time.Second)} {
+		code, err := utils.TOTPCode(secret, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		codes = append(codes, code)
+	}
+	return codes
+}
+
+// enableTOTP sets 2FA up for the user of token and returns the recovery codes
+// and the two codes left unused
+func (s *testServer) enableTOTP(token string) (recoveryCodes, codes []string) {
+	s.t.Helper()
+	setup := s.expect(s.do(http.MethodPost, "/secure/2fa/totp", token, nil), http.StatusOK)
+	codes = totpCodes(s.t, setup["secret"].(string))
+	confirmed := s.expect(s.do(http.MethodPost, "/secure/2fa/totp/confirm", token, map[string]any{"code": codes[0]}), http.StatusOK)
+	return stringList(confirmed["recovery_codes"]), codes[1:]
+}
+
+func TestTwoFactorRoles(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) { cfg.Auth.TwoFactorRoles = []string{"catalog_manager"} })
+	s.createUser("manager@example.com", "catalog_manager")
+
+	// The role is withheld until 2FA is enabled
+	login := s.login("manager@example.com")
+	if withheld := stringList(login["two_factor_required_roles"]); !slices.Equal(withheld, []string{"catalog_manager"}) {
+		t.Errorf("got withheld roles %v, want catalog_manager", withheld)
+	}
+	token := login["token"].(string)
+	s.expect(s.do(http.MethodPost, "/register-product", token, testProduct), http.StatusForbidden)
+	s.expect(s.do(http.MethodDelete, "/secure/2fa/totp", token, map[string]any{"code": "123456"}), http.StatusForbidden)
+
+	_, codes := s.enableTOTP(token)
+
+	challenge := s.login("manager@example.com")
+	if challenge["status"] != "two_factor_required" || challenge["token"] != nil {
+		t.Fatalf("got %v, want a 2FA challenge", challenge)
+	}
+	verified := s.expect(s.do(http.MethodPost, "/login/2fa", "", map[string]any{
+		"challenge_token": challenge["challenge_token"],
+		"code":            codes[0],
+	}), http.StatusOK)
+	token = verified["token"].(string)
+	if amr := stringList(claims(t, token)["amr"]); !slices.Contains(amr, utils.AMROTP) {
+		t.Errorf("got amr %v, want otp", amr)
+	}
+	s.expect(s.do(http.MethodPost, "/register-product", token, testProduct), http.StatusOK)
+}
+
+func TestLoginTwoFactor(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("ada@example.com")
+	recoveryCodes, codes := s.enableTOTP(s.token("ada@example.com"))
+
+	challenge := func() string {
+		return s.login("ada@example.com")["challenge_token"].(string)
+	}
+	verify := func(body map[string]any) map[string]any {
+		return decode(t, s.do(http.MethodPost, "/login/2fa", "", body))
+	}
+
+	first := challenge()
+	s.expect(s.do(http.MethodPost, "/login/2fa", "", map[string]any{"challenge_token": first}), http.StatusBadRequest)
+	s.expect(s.do(http.MethodPost, "/login/2fa", "", map[string]any{"challenge_token": "unknown", "code": codes[0]}), http.StatusUnauthorized)
+
+	// A typo keeps the challenge
+	wrong := "000000"
+	if slices.Contains(codes, wrong) {
+		wrong = "111111"
+	}
+	s.expect(s.do(http.MethodPost, "/login/2fa", "", map[string]any{"challenge_token": first, "code": wrong}), http.StatusUnauthorized)
+	if body := verify(map[string]any{"challenge_token": first, "code": codes[0]}); body["token"] == nil {
+		t.Fatalf("got %v, want the tokens", body)
+	}
+
+	// Challenges and codes are single use
+	s.expect(s.do(http.MethodPost, "/login/2fa", "", map[string]any{"challenge_token": first, "code": codes[1]}), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodPost, "/login/2fa", "", map[string]any{"challenge_token": challenge(), "code": codes[0]}), http.StatusUnauthorized)
+
+	if body := verify(map[string]any{"challenge_token": challenge(), "recovery_code": recoveryCodes[0]}); body["token"] == nil {
+		t.Fatalf("got %v, want the tokens", body)
+	}
+	s.expect(s.do(http.MethodPost, "/login/2fa", "", map[string]any{"challenge_token": challenge(), "recovery_code": recoveryCodes[0]}), http.StatusUnauthorized)
+}
+
+func TestEnablingTwoFactorDoesNotUpgradeSessions(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) { cfg.Auth.TwoFactorRoles = []string{"catalog_manager"} })
+	s.createUser("manager@example.com", "catalog_manager")
+	current := s.login("manager@example.com")
+	other := s.login("manager@example.com")
+
+	s.enableTOTP(current["token"].(string))
+
+	// The other sessions end, the current one keeps its password-only login
+	s.expect(s.do(http.MethodPost, "/token/refresh", "", map[string]any{"refresh_token": other["refresh_token"]}), http.StatusUnauthorized)
+	s.expect(s.do(http.MethodGet, "/secure/me", other["token"].(string), nil), http.StatusUnauthorized)
+
+	refreshed := s.expect(s.do(http.MethodPost, "/token/refresh", "", map[string]any{"refresh_token": current["refresh_token"]}), http.StatusOK)
+	token := refreshed["token"].(string)
+	if amr := stringList(claims(t, token)["amr"]); !slices.Equal(amr, []string{utils.AMRPassword}) {
+		t.Errorf("got amr %v after the refresh, want pwd", amr)
+	}
+	if roles := stringList(claims(t, token)["roles"]); slices.Contains(roles, "catalog_manager") {
+		t.Errorf("got roles %v, the role needs a login with 2FA", roles)
+	}
+	s.expect(s.do(http.MethodPost, "/register-product", token, testProduct), http.StatusForbidden)
+}
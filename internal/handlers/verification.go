@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/0xSumeet/go_api/internal/database"
+	"github.com/0xSumeet/go_api/internal/mailer"
+	"github.com/0xSumeet/go_api/pkg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sendVerificationEmail replaces the pending verification link of user and
+// emails the new one
+func (h *Handler) sendVerificationEmail(ctx context.Context, user *database.User) error {
+	if err := h.UserTokens.DeleteUserTokens(ctx, user.ID, database.TokenPurposeEmailVerification); err != nil {
+		return err
+	}
+
+	token, tokenHash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+	err = h.UserTokens.CreateUserToken(ctx, &database.UserToken{
+		UserID:    user.ID,
+		Purpose:   database.TokenPurposeEmailVerification,
+		TokenHash: tokenHash,
+		ExpiresAt: time.Now().Add(h.Config.Auth.EmailVerificationTTL.Duration),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := h.Config.PublicURL + "/verify-email?token=" + url.QueryEscape(token)
+	h.sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf(
+			"Hello %s,\n\nUse this link to verify your email address:\n\n%s\n\nThe link expires in %s.",
+			user.Name, link, h.Config.Auth.EmailVerificationTTL.Duration,
+		),
+	})
+	return nil
+}
+
+// VerifyEmail marks the email of the user as verified with the token of the
+// link sent at signup
+func (h *Handler) VerifyEmail(c *gin.Context) {
+	tokenParam := c.Query("token")
+	if tokenParam == "" {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": "please provide the token"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	token, err := h.UserTokens.ConsumeUserToken(ctx, database.TokenPurposeEmailVerification, utils.HashToken(tokenParam))
+	if errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": "invalid or expired token"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+
+	err = h.Users.MarkEmailVerified(ctx, token.UserID)
+	if errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": "invalid or expired token"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]any{"message": "email address verified", "status": "success"})
+}
+
+// ResendVerification emails a new verification link, at most once per resend
+// interval. The response is the same whether the email exists, is already
+// verified or was rate limited.
+func (h *Handler) ResendVerification(c *gin.Context) {
+	var request struct {
+		Email string `json:"email"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil || request.Email == "" {
+		c.JSON(http.StatusBadRequest, map[string]any{"error": "please provide the email"})
+		return
+	}
+
+	accepted := map[string]any{
+		"message": "if the account needs it, a verification email has been sent",
+		"status":  "success",
+	}
+
+	ctx := c.Request.Context()
+	user, err := h.Users.GetUserByEmail(ctx, request.Email)
+	if errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusOK, accepted)
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+	if user.EmailVerified() {
+		c.JSON(http.StatusOK, accepted)
+		return
+	}
+
+	latest, err := h.UserTokens.GetLatestUserToken(ctx, user.ID, database.TokenPurposeEmailVerification)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "database error"})
+		return
+	}
+	if err == nil && time.Since(latest.CreatedAt) < h.Config.Auth.VerificationResendInterval.Duration {
+		c.JSON(http.StatusOK, accepted)
+		return
+	}
+
+	if err := h.sendVerificationEmail(ctx, user); err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "could not send verification email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, accepted)
+}
@@ -0,0 +1,136 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/0xSumeet/go_api/internal/migrations"
+)
+
+const (
+	StatusUp   string = "up"
+	StatusDown string = "down"
+)
+
+// CheckFunc checks one dependency, the returned details are added to the report
+type CheckFunc func(ctx context.Context) (map[string]any, error)
+
+type Result struct {
+	Name      string         `json:"name"`
+	Status    string         `json:"status"`
+	LatencyMS float64        `json:"latency_ms"`
+	Error     string         `json:"error,omitempty"`
+	Details   map[string]any `json:"details,omitempty"`
+}
+
+type Report struct {
+	Status string   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+// Registry holds the dependency checks run by the readiness endpoint
+type Registry struct {
+	mu      sync.RWMutex
+	timeout time.Duration
+	checks  map[string]CheckFunc
+}
+
+func NewRegistry(timeout time.Duration) *Registry {
+	return &Registry{timeout: timeout, checks: map[string]CheckFunc{}}
+}
+
+// Register adds a check, registering the same name again replaces it
+func (r *Registry) Register(name string, check CheckFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.checks[name] = check
+}
+
+// Run runs every check concurrently, each bounded by the registry timeout
+func (r *Registry) Run(ctx context.Context) Report {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.checks))
+	for name := range r.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	checks := make([]CheckFunc, len(names))
+	for i, name := range names {
+		checks[i] = r.checks[name]
+	}
+	r.mu.RUnlock()
+
+	results := make([]Result, len(names))
+	var wg sync.WaitGroup
+	for i := range names {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = r.run(ctx, names[i], checks[i])
+		}(i)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusUp, Checks: results}
+	for _, result := range results {
+		if result.Status != StatusUp {
+			report.Status = StatusDown
+		}
+	}
+	return report
+}
+
+func (r *Registry) run(ctx context.Context, name string, check CheckFunc) Result {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	start := time.Now()
+	details, err := check(ctx)
+	result := Result{
+		Name:      name,
+		Status:    StatusUp,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+		Details:   details,
+	}
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// Database pings the database and reports the connection pool stats
+func Database(db *sql.DB) CheckFunc {
+	return func(ctx context.Context) (map[string]any, error) {
+		stats := db.Stats()
+		details := map[string]any{
+			"max_open_connections": stats.MaxOpenConnections,
+			"open_connections":     stats.OpenConnections,
+			"in_use":               stats.InUse,
+			"idle":                 stats.Idle,
+			"wait_count":           stats.WaitCount,
+			"wait_duration_ms":     stats.WaitDuration.Milliseconds(),
+		}
+		return details, db.PingContext(ctx)
+	}
+}
+
+// Migrations fails while some embedded migrations are not applied
+func Migrations(runner *migrations.Runner) CheckFunc {
+	return func(ctx context.Context) (map[string]any, error) {
+		pending, err := runner.Pending(ctx)
+		if err != nil {
+			return nil, err
+		}
+		details := map[string]any{"pending": pending}
+		if pending > 0 {
+			return details, fmt.Errorf("%d pending migrations", pending)
+		}
+		return details, nil
+	}
+}
@@ -0,0 +1,63 @@
+package lockout
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter allows limit requests per key within a sliding window. It counts in
+// memory, so each instance of the server has its own counts.
+type Limiter struct {
+	mu       sync.Mutex
+	limit    int
+	window   time.Duration
+	requests map[string][]time.Time
+	pruned   time.Time
+	// now is the clock of the limiter, replaced in tests
+	now func() time.Time
+}
+
+// NewLimiter returns a limiter of limit requests per window, a limit or a
+// window of 0 allows every request
+func NewLimiter(limit int, window time.Duration) *Limiter {
+	return &Limiter{limit: limit, window: window, requests: map[string][]time.Time{}, now: time.Now}
+}
+
+// Allow records a request for key and returns 0, or how long to wait when
+// the key is over the limit, the refused requests are not recorded
+func (l *Limiter) Allow(key string) time.Duration {
+	if l.limit <= 0 || l.window <= 0 {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	since := now.Add(-l.window)
+	l.prune(now, since)
+
+	requests := l.requests[key]
+	for len(requests) > 0 && !requests[0].After(since) {
+		requests = requests[1:]
+	}
+	if len(requests) >= l.limit {
+		l.requests[key] = requests
+		return requests[0].Sub(since)
+	}
+	l.requests[key] = append(requests, now)
+	return 0
+}
+
+// prune forgets the keys without request in the window, once per window
+func (l *Limiter) prune(now, since time.Time) {
+	if now.Sub(l.pruned) < l.window {
+		return
+	}
+	l.pruned = now
+	for key, requests := range l.requests {
+		if !requests[len(requests)-1].After(since) {
+			delete(l.requests, key)
+		}
+	}
+}
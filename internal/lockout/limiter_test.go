@@ -0,0 +1,39 @@
+package lockout
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	limiter := NewLimiter(2, time.Hour)
+	for i := 0; i < 2; i++ {
+		if wait := limiter.Allow("a"); wait != 0 {
+			t.Fatalf("request %d: got wait %s, want allowed", i, wait)
+		}
+	}
+	if wait := limiter.Allow("a"); wait <= 0 || wait > time.Hour {
+		t.Errorf("got wait %s, want up to an hour", wait)
+	}
+	if wait := limiter.Allow("b"); wait != 0 {
+		t.Errorf("got wait %s for another key, want allowed", wait)
+	}
+
+	// The requests leave the window
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	limiter = NewLimiter(1, time.Minute)
+	limiter.now = func() time.Time { return now }
+	limiter.Allow("a")
+	now = now.Add(20 * time.Second)
+	if wait := limiter.Allow("a"); wait != 40*time.Second {
+		t.Errorf("got wait %s within the window, want 40s", wait)
+	}
+	now = now.Add(40 * time.Second)
+	if wait := limiter.Allow("a"); wait != 0 {
+		t.Errorf("got wait %s after the window, want allowed", wait)
+	}
+
+	if wait := NewLimiter(0, time.Hour).Allow("a"); wait != 0 {
+		t.Errorf("got wait %s without limit, want allowed", wait)
+	}
+}
@@ -0,0 +1,88 @@
+package lockout
+
+import (
+	"context"
+	"time"
+
+	"github.com/0xSumeet/go_api/internal/configs"
+	"github.com/0xSumeet/go_api/internal/database"
+)
+
+// Guard throttles the logins of an account and of a client IP after repeated
+// failures, with a delay doubling on each failure past the threshold
+type Guard struct {
+	attempts database.LoginAttemptRepository
+	cfg      config.Lockout
+}
+
+func New(attempts database.LoginAttemptRepository, cfg config.Lockout) *Guard {
+	return &Guard{attempts: attempts, cfg: cfg}
+}
+
+// Check returns how long to wait before a login on email from ip is allowed,
+// 0 when it is. Unknown emails are throttled the same way as accounts.
+func (g *Guard) Check(ctx context.Context, email, ip string) (time.Duration, error) {
+	now := time.Now()
+	since := now.Add(-g.cfg.Window.Duration)
+
+	account, err := g.attempts.AccountFailures(ctx, database.NormalizeEmail(email), since)
+	if err != nil {
+		return 0, err
+	}
+	client, err := g.attempts.IPFailures(ctx, ip, since)
+	if err != nil {
+		return 0, err
+	}
+
+	until := g.lockedUntil(account, g.cfg.AccountThreshold)
+	if clientUntil := g.lockedUntil(client, g.cfg.IPThreshold); clientUntil.After(until) {
+		until = clientUntil
+	}
+	if !until.After(now) {
+		return 0, nil
+	}
+	return until.Sub(now), nil
+}
+
+// lockedUntil returns when the next attempt is allowed after failures
+func (g *Guard) lockedUntil(failures database.LoginFailures, threshold int) time.Time {
+	if failures.Count < threshold {
+		return time.Time{}
+	}
+	delay := g.cfg.BaseDelay.Duration
+	for i := threshold; i < failures.Count && delay < g.cfg.MaxDelay.Duration; i++ {
+		delay *= 2
+	}
+	if delay > g.cfg.MaxDelay.Duration {
+		delay = g.cfg.MaxDelay.Duration
+	}
+	return failures.Last.Add(delay)
+}
+
+// Fail records a failed login, userID is nil when the email is unknown
+func (g *Guard) Fail(ctx context.Context, userID *int, email, ip string) error {
+	return g.attempts.RecordLoginAttempt(ctx, &database.LoginAttempt{
+		UserID: userID,
+		Email:  database.NormalizeEmail(email),
+		IP:     ip,
+	})
+}
+
+// Succeed records a successful login and resets the failures of the account
+func (g *Guard) Succeed(ctx context.Context, userID int, email, ip string) error {
+	err := g.attempts.RecordLoginAttempt(ctx, &database.LoginAttempt{
+		UserID:    &userID,
+		Email:     database.NormalizeEmail(email),
+		IP:        ip,
+		Succeeded: true,
+	})
+	if err != nil {
+		return err
+	}
+	return g.Unlock(ctx, userID, email)
+}
+
+// Unlock resets the failures of the account, the IP throttling is unchanged
+func (g *Guard) Unlock(ctx context.Context, userID int, email string) error {
+	return g.attempts.ClearAccountFailures(ctx, database.NormalizeEmail(email), userID)
+}
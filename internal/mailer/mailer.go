@@ -0,0 +1,137 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0xSumeet/go_api/internal/configs"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers the emails sent by the server
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
+
+// New returns the mailer selected by the configuration
+func New(cfg config.Mail) (Mailer, error) {
+	switch cfg.Driver {
+	case "smtp":
+		return NewSMTPMailer(cfg), nil
+	case "outbox":
+		return NewOutboxMailer(cfg.OutboxDir), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", cfg.Driver)
+	}
+}
+
+// SMTPMailer sends emails through an SMTP server, with PLAIN auth when a
+// username is set
+type SMTPMailer struct {
+	addr     string
+	host     string
+	from     string
+	username string
+	password string
+}
+
+func NewSMTPMailer(cfg config.Mail) *SMTPMailer {
+	return &SMTPMailer{
+		addr:     net.JoinHostPort(cfg.SMTP.Host, fmt.Sprint(cfg.SMTP.Port)),
+		host:     cfg.SMTP.Host,
+		from:     cfg.From,
+		username: cfg.SMTP.Username,
+		password: cfg.SMTP.Password,
+	}
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, message Message) error {
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+	err := smtp.SendMail(m.addr, auth, m.from, []string{message.To}, format(m.from, message))
+	if err != nil {
+		return fmt.Errorf("could not send email: %v", err)
+	}
+	return nil
+}
+
+// OutboxMailer writes every email to a file of dir, or to the log when dir is
+// empty, and keeps them in memory. It is meant for development and tests.
+type OutboxMailer struct {
+	dir      string
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewOutboxMailer(dir string) *OutboxMailer {
+	return &OutboxMailer{dir: dir}
+}
+
+func (m *OutboxMailer) Send(ctx context.Context, message Message) error {
+	m.mu.Lock()
+	m.messages = append(m.messages, message)
+	count := len(m.messages)
+	m.mu.Unlock()
+
+	if m.dir == "" {
+		log.Printf("Outbox email to %s: %s\n%s", message.To, message.Subject, message.Body)
+		return nil
+	}
+
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return fmt.Errorf("could not create outbox: %v", err)
+	}
+	name := fmt.Sprintf("%d-%04d.eml", time.Now().UnixNano(), count)
+	if err := os.WriteFile(filepath.Join(m.dir, name), format("outbox", message), 0o644); err != nil {
+		return fmt.Errorf("could not write email: %v", err)
+	}
+	return nil
+}
+
+// Messages returns the emails sent so far
+func (m *OutboxMailer) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Message(nil), m.messages...)
+}
+
+// Last returns the last email sent to address
+func (m *OutboxMailer) Last(address string) (Message, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].To == address {
+			return m.messages[i], true
+		}
+	}
+	return Message{}, false
+}
+
+func format(from string, message Message) []byte {
+	// Header values come from the server, line breaks are stripped anyway
+	clean := strings.NewReplacer("\r", "", "\n", "")
+	return []byte(fmt.Sprintf(
+		"From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n",
+		clean.Replace(from),
+		clean.Replace(message.To),
+		clean.Replace(message.Subject),
+		message.Body,
+	))
+}
@@ -1,18 +1,50 @@
 package auth
 
 import (
+	"crypto/subtle"
+	"errors"
+	"log"
 	"net/http"
 	"strings"
+	"time"
 
-	"github.com/0xSumeet/go_api/internal/configs"
+	"github.com/0xSumeet/go_api/internal/database"
+	"github.com/0xSumeet/go_api/internal/rbac"
 	"github.com/0xSumeet/go_api/pkg/utils"
 
-	jwtlib "github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
 )
 
-func AuthMiddleware() gin.HandlerFunc {
+// Context keys set by AuthMiddleware
+const (
+	// ClaimsKey holds the *utils.Claims of the authenticated token
+	ClaimsKey = "claims"
+	// UserIDKey holds the int id of the authenticated user, unset for service keys
+	UserIDKey = "user_id"
+	// APIKeyKey holds the *database.APIKey of a request authenticated by X-API-Key
+	APIKeyKey = "api_key"
+	// ScopesKey holds the []string permissions granted to that API key
+	ScopesKey = "scopes"
+
+	emailVerifiedKey = "email_verified"
+)
+
+// APIKeyHeader carries the API keys of machine clients
+const APIKeyHeader = "X-API-Key"
+
+// AuthMiddleware authenticates the X-API-Key header, or else the bearer token
+// issued by issuer for audience
+func AuthMiddleware(keys *utils.KeySet, store *database.Store, issuer, audience string) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if apiKey := c.GetHeader(APIKeyHeader); apiKey != "" {
+			if !authenticateAPIKey(c, store, apiKey) {
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+
 		// Get the token from the request header
 		tokenString := c.GetHeader("Authorization")
 
@@ -28,27 +60,222 @@ func AuthMiddleware() gin.HandlerFunc {
 
 		// Remove the "Bearer " prefix from the token string
 		tokenString = strings.TrimPrefix(tokenString, "Bearer ")
-		// Parse the token
-		claims := &utils.Claims{}
-		token, err := jwtlib.ParseWithClaims(
-			tokenString,
-			claims,
-			func(token *jwtlib.Token) (interface{}, error) {
-				return []byte(config.JWTSecret), nil // Replace with your secret key
-			},
-		)
-
-		// Check if the token is valid
-		if err != nil || !token.Valid {
+		// Parse the token and check if it is valid
+		claims, err := utils.ParseJWT(keys, tokenString, issuer, audience)
+		if err != nil {
 			c.JSON(http.StatusUnauthorized, map[string]any{"error": "Invalid or expired token"})
 			c.Abort()
 			return
 		}
 
+		// Check if the token was revoked by a logout
+		isRevoked, err := store.RevokedTokens.IsTokenRevoked(c.Request.Context(), claims.Id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, map[string]any{"error": "could not check token"})
+			c.Abort()
+			return
+		}
+		if isRevoked {
+			c.JSON(http.StatusUnauthorized, map[string]any{"error": "Token has been revoked"})
+			c.Abort()
+			return
+		}
+
+		// Tokens end with their session, tokens issued before sessions have none
+		if claims.SessionID != "" {
+			session, err := store.Sessions.GetSession(c.Request.Context(), claims.SessionID)
+			if err != nil && !errors.Is(err, database.ErrNotFound) {
+				c.JSON(http.StatusInternalServerError, map[string]any{"error": "could not check token"})
+				c.Abort()
+				return
+			}
+			if err != nil || !session.Active(time.Now()) {
+				c.JSON(http.StatusUnauthorized, map[string]any{"error": "Session has ended"})
+				c.Abort()
+				return
+			}
+			if err := store.Sessions.TouchSession(c.Request.Context(), session.ID, time.Time{}); err != nil {
+				log.Printf("could not update last use of session %s: %v", session.ID, err)
+			}
+		}
+
 		// If the token is valid, store user info in the context
-		c.Set("username", claims.Username)
+		userID, _ := claims.UserID()
+		c.Set(UserIDKey, userID)
+		c.Set(ClaimsKey, claims)
+		c.Set(emailVerifiedKey, claims.EmailVerified)
 
 		// Proceed with the request
 		c.Next()
 	}
 }
+
+// authenticateAPIKey stores the key and its scopes in the context, or writes the
+// error response and returns false
+func authenticateAPIKey(c *gin.Context, store *database.Store, apiKey string) bool {
+	ctx := c.Request.Context()
+	prefix, ok := utils.ParseAPIKeyPrefix(apiKey)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, map[string]any{"error": "Invalid API key"})
+		return false
+	}
+
+	key, err := store.APIKeys.GetAPIKeyByPrefix(ctx, prefix)
+	if errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusUnauthorized, map[string]any{"error": "Invalid API key"})
+		return false
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, map[string]any{"error": "could not check API key"})
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(key.KeyHash), []byte(utils.HashToken(apiKey))) != 1 {
+		c.JSON(http.StatusUnauthorized, map[string]any{"error": "Invalid API key"})
+		return false
+	}
+	if !key.Active(time.Now()) {
+		c.JSON(http.StatusUnauthorized, map[string]any{"error": "API key has been revoked or has expired"})
+		return false
+	}
+
+	scopes := key.Scopes
+	emailVerified := true
+	if key.UserID != nil {
+		// A user key keeps only the scopes its owner is still granted
+		user, err := store.Users.GetUserByID(ctx, *key.UserID)
+		if errors.Is(err, database.ErrNotFound) {
+			c.JSON(http.StatusUnauthorized, map[string]any{"error": "Invalid API key"})
+			return false
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, map[string]any{"error": "could not check API key"})
+			return false
+		}
+		roles, err := store.Roles.GetUserRoles(ctx, user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, map[string]any{"error": "could not check API key"})
+			return false
+		}
+
+		scopes = []string{}
+		for _, scope := range key.Scopes {
+			if rbac.HasPermission(roles, scope) {
+				scopes = append(scopes, scope)
+			}
+		}
+		emailVerified = user.EmailVerified()
+		c.Set(UserIDKey, user.ID)
+	}
+
+	if err := store.APIKeys.TouchAPIKey(ctx, key.ID); err != nil {
+		log.Printf("could not update last use of api key %d: %v", key.ID, err)
+	}
+
+	c.Set(APIKeyKey, key)
+	c.Set(ScopesKey, scopes)
+	c.Set(emailVerifiedKey, emailVerified)
+	return true
+}
+
+// GetAPIKey returns the API key stored by AuthMiddleware
+func GetAPIKey(c *gin.Context) (*database.APIKey, bool) {
+	value, ok := c.Get(APIKeyKey)
+	if !ok {
+		return nil, false
+	}
+	key, ok := value.(*database.APIKey)
+	return key, ok
+}
+
+// GetClaims returns the claims stored by AuthMiddleware
+func GetClaims(c *gin.Context) (*utils.Claims, bool) {
+	value, ok := c.Get(ClaimsKey)
+	if !ok {
+		return nil, false
+	}
+	claims, ok := value.(*utils.Claims)
+	return claims, ok
+}
+
+// CurrentUserID returns the id of the authenticated user
+func CurrentUserID(c *gin.Context) (int, bool) {
+	userID, ok := c.Get(UserIDKey)
+	if !ok {
+		return 0, false
+	}
+	id, ok := userID.(int)
+	return id, ok
+}
+
+// CurrentUser loads the authenticated user, it returns database.ErrNotFound when
+// the request is not authenticated or the account was deleted since
+func CurrentUser(c *gin.Context, users database.UserRepository) (*database.User, error) {
+	userID, ok := CurrentUserID(c)
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	return users.GetUserByID(c.Request.Context(), userID)
+}
+
+// RequirePermission aborts with 403 unless one of the roles of the token, or the
+// scopes of the API key, grants permission, it must run after AuthMiddleware
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var allowed bool
+		if claims, ok := GetClaims(c); ok {
+			allowed = rbac.HasPermission(claims.Roles, permission)
+		} else if scopes, ok := c.Get(ScopesKey); ok {
+			for _, scope := range scopes.([]string) {
+				allowed = allowed || scope == permission
+			}
+		} else {
+			c.JSON(http.StatusUnauthorized, map[string]any{"error": "not authenticated"})
+			c.Abort()
+			return
+		}
+
+		if !allowed {
+			c.JSON(
+				http.StatusForbidden,
+				map[string]any{"error": "missing permission " + permission},
+			)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireVerifiedEmail aborts with 403 unless the token or API key owner verified
+// its email, service keys have no owner and pass, it must run after AuthMiddleware
+func RequireVerifiedEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		verified, ok := c.Get(emailVerifiedKey)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, map[string]any{"error": "not authenticated"})
+			c.Abort()
+			return
+		}
+
+		if verified, _ := verified.(bool); !verified {
+			c.JSON(http.StatusForbidden, map[string]any{"error": "email address not verified"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireLogin aborts with 403 for API keys, it guards the account endpoints
+// that need a user token and must run after AuthMiddleware
+func RequireLogin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := GetAPIKey(c); ok {
+			c.JSON(http.StatusForbidden, map[string]any{"error": "not allowed with an API key"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
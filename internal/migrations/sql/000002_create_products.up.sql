@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS products (
+    product_id     SERIAL PRIMARY KEY,
+    product_name   TEXT           NOT NULL,
+    category       TEXT           NOT NULL DEFAULT '',
+    stock_quantity INTEGER        NOT NULL DEFAULT 0,
+    price          NUMERIC(12, 2) NOT NULL,
+    created_at     TIMESTAMPTZ    NOT NULL DEFAULT NOW(),
+    updated_at     TIMESTAMPTZ    NOT NULL DEFAULT NOW(),
+    CONSTRAINT products_stock_quantity_check CHECK (stock_quantity >= 0),
+    CONSTRAINT products_price_check CHECK (price >= 0)
+);
+
+CREATE INDEX IF NOT EXISTS products_category_idx ON products (category);
@@ -0,0 +1,18 @@
+-- TOTP secret of each user, enabled once confirmed with a first code
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id        INTEGER     PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    secret         TEXT        NOT NULL,
+    confirmed_at   TIMESTAMPTZ,
+    -- last_used_step refuses a code used twice
+    last_used_step BIGINT      NOT NULL DEFAULT 0,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    INTEGER     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    code_hash  TEXT        NOT NULL,
+    used_at    TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT user_recovery_codes_user_id_code_hash_key UNIQUE (user_id, code_hash)
+);
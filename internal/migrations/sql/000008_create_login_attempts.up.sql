@@ -0,0 +1,15 @@
+-- History of the logins, failed attempts throttle the account and the client IP
+CREATE TABLE IF NOT EXISTS login_attempts (
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    INTEGER     REFERENCES users (id) ON DELETE SET NULL,
+    email      TEXT        NOT NULL,
+    ip         TEXT        NOT NULL,
+    succeeded  BOOLEAN     NOT NULL,
+    -- cleared failures no longer lock the account, after a success or an unlock
+    cleared    BOOLEAN     NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS login_attempts_email_created_at_idx ON login_attempts (email, created_at);
+CREATE INDEX IF NOT EXISTS login_attempts_ip_created_at_idx ON login_attempts (ip, created_at);
+CREATE INDEX IF NOT EXISTS login_attempts_user_id_created_at_idx ON login_attempts (user_id, created_at);
@@ -0,0 +1,2 @@
+-- Incremented on every write, it is the ETag of the product
+ALTER TABLE products ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
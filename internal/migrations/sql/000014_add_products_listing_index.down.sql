@@ -0,0 +1 @@
+DROP INDEX IF EXISTS products_category_price_idx;
@@ -0,0 +1,2 @@
+-- Serves the category pages sorted by price
+CREATE INDEX IF NOT EXISTS products_category_price_idx ON products (category, price, product_id) WHERE deleted_at IS NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE user_tokens DROP COLUMN IF EXISTS login_method;
+ALTER TABLE sessions DROP COLUMN IF EXISTS amr;
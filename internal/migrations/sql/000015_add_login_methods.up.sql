@@ -0,0 +1,7 @@
+-- The authentication methods of a login are kept by its session, so refreshed
+-- tokens never claim more than the login proved. Older sessions count as
+-- password logins and get the roles requiring 2FA back at their next login.
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS amr TEXT[] NOT NULL DEFAULT '{pwd}';
+
+-- The first factor of the login a 2FA challenge continues
+ALTER TABLE user_tokens ADD COLUMN IF NOT EXISTS login_method TEXT NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+-- The original case of the emails is not kept, they stay normalized
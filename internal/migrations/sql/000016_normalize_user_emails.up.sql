@@ -0,0 +1,10 @@
+-- Emails are now stored in lower case without surrounding spaces, and looked up
+-- the same way. The accounts whose emails only differ by case keep them as they
+-- are, an admin has to merge or rename them.
+UPDATE users
+SET email = lower(trim(email))
+WHERE email <> lower(trim(email))
+  AND NOT EXISTS (
+      SELECT 1 FROM users other
+      WHERE other.id <> users.id AND lower(trim(other.email)) = lower(trim(users.email))
+  );
@@ -0,0 +1,156 @@
+package oidc
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/0xSumeet/go_api/pkg/utils"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// clockSkew is the tolerance on the time claims of the ID tokens
+const clockSkew = time.Minute
+
+// IDToken holds the verified claims identifying the user
+type IDToken struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// audience is a single string or an array in the ID tokens
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return fmt.Errorf("invalid aud claim")
+	}
+	*a = many
+	return nil
+}
+
+// flexibleBool accepts the "true" strings some providers send for email_verified
+type flexibleBool bool
+
+func (b *flexibleBool) UnmarshalJSON(data []byte) error {
+	var value bool
+	if err := json.Unmarshal(data, &value); err == nil {
+		*b = flexibleBool(value)
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("invalid boolean claim")
+	}
+	value, err := strconv.ParseBool(s)
+	if err != nil {
+		return fmt.Errorf("invalid boolean claim")
+	}
+	*b = flexibleBool(value)
+	return nil
+}
+
+type idTokenClaims struct {
+	Issuer          string       `json:"iss"`
+	Subject         string       `json:"sub"`
+	Audience        audience     `json:"aud"`
+	AuthorizedParty string       `json:"azp"`
+	ExpiresAt       int64        `json:"exp"`
+	IssuedAt        int64        `json:"iat"`
+	NotBefore       int64        `json:"nbf"`
+	Nonce           string       `json:"nonce"`
+	Email           string       `json:"email"`
+	EmailVerified   flexibleBool `json:"email_verified"`
+	Name            string       `json:"name"`
+}
+
+// Valid checks the time claims, the others depend on the provider
+func (c *idTokenClaims) Valid() error {
+	now := time.Now()
+	if c.ExpiresAt == 0 || now.After(time.Unix(c.ExpiresAt, 0).Add(clockSkew)) {
+		return fmt.Errorf("token is expired")
+	}
+	if c.IssuedAt == 0 || now.Add(clockSkew).Before(time.Unix(c.IssuedAt, 0)) {
+		return fmt.Errorf("token is issued in the future")
+	}
+	if c.NotBefore != 0 && now.Add(clockSkew).Before(time.Unix(c.NotBefore, 0)) {
+		return fmt.Errorf("token is not valid yet")
+	}
+	return nil
+}
+
+func (a audience) contains(clientID string) bool {
+	for _, aud := range a {
+		if aud == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// idTokenParser only accepts the asymmetric algorithms, a provider cannot be
+// trusted with an HMAC of its public key
+var idTokenParser = &jwt.Parser{ValidMethods: []string{"RS256", "ES256", utils.SigningMethodEdDSA.Alg()}}
+
+// VerifyIDToken checks the signature of raw with the provider keys, its
+// issuer, audience, lifetime and that it carries nonce
+func (p *Provider) VerifyIDToken(ctx context.Context, raw, nonce string) (*IDToken, error) {
+	var claims idTokenClaims
+	var keyErr error
+	_, err := idTokenParser.ParseWithClaims(raw, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		jwk, err := p.key(ctx, kid)
+		if err != nil {
+			keyErr = err
+			return nil, err
+		}
+		// The algorithm of the header must be the one of the key
+		if jwk.Alg != "" && jwk.Alg != token.Method.Alg() {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return jwk.PublicKey()
+	})
+	// A provider whose keys cannot be fetched is unavailable, not lying
+	if keyErr != nil {
+		return nil, keyErr
+	} else if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	if claims.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidIDToken, claims.Issuer)
+	}
+	if !claims.Audience.contains(p.config.ClientID) {
+		return nil, fmt.Errorf("%w: token is not for this client", ErrInvalidIDToken)
+	}
+	// A token for several audiences must name this client as the authorized party
+	if (len(claims.Audience) > 1 || claims.AuthorizedParty != "") && claims.AuthorizedParty != p.config.ClientID {
+		return nil, fmt.Errorf("%w: token is authorized for another party", ErrInvalidIDToken)
+	}
+	// The nonce ties the token to the login that started it
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	}
+
+	return &IDToken{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		Name:          claims.Name,
+	}, nil
+}
@@ -0,0 +1,269 @@
+// Package oidc logs users in with OpenID Connect providers, using the
+// authorization code flow with PKCE and verifying the ID tokens with the keys
+// the provider publishes.
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0xSumeet/go_api/internal/configs"
+	"github.com/0xSumeet/go_api/pkg/utils"
+)
+
+var (
+	// ErrCodeRejected is returned when the provider refuses the authorization code
+	ErrCodeRejected = errors.New("the provider rejected the authorization code")
+	// ErrInvalidIDToken is returned when the ID token fails verification
+	ErrInvalidIDToken = errors.New("invalid id token")
+)
+
+// jwksRefreshInterval limits the fetches of the provider keys for unknown key ids
+const jwksRefreshInterval = time.Minute
+
+// Provider is a configured OpenID Connect provider, its endpoints and keys are
+// fetched on first use and cached
+type Provider struct {
+	Name   string
+	config config.OIDCProvider
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery *discovery
+	keys      map[string]utils.JWK
+	keysAt    time.Time
+}
+
+// discovery is the part of the provider metadata the login flow uses
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Providers are the configured providers by name
+type Providers map[string]*Provider
+
+// NewProviders returns the providers of cfg, with the default redirect URL
+// filled in
+func NewProviders(cfg *config.Config) Providers {
+	providers := Providers{}
+	for _, provider := range cfg.Auth.OIDCProviders {
+		if provider.RedirectURL == "" {
+			provider.RedirectURL = strings.TrimRight(cfg.PublicURL, "/") + "/login/oidc/" + provider.Name + "/callback"
+		}
+		providers[provider.Name] = NewProvider(provider, nil)
+	}
+	return providers
+}
+
+// NewProvider returns the provider of cfg, the scopes default to openid, email
+// and profile and client to one with a 10 second timeout
+func NewProvider(cfg config.OIDCProvider, client *http.Client) *Provider {
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Provider{Name: cfg.Name, config: cfg, client: client}
+}
+
+// metadata returns the discovery document of the provider, it is only cached
+// once fetched successfully
+func (p *Provider) metadata(ctx context.Context) (*discovery, error) {
+	p.mu.Lock()
+	cached := p.discovery
+	p.mu.Unlock()
+	if cached != nil {
+		return cached, nil
+	}
+
+	var doc discovery
+	wellKnown := strings.TrimRight(p.config.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, wellKnown, &doc); err != nil {
+		return nil, fmt.Errorf("could not discover provider %s: %v", p.Name, err)
+	}
+	// The issuer of the document must be the configured one, it is the iss of the tokens
+	if doc.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("provider %s announces issuer %q instead of %q", p.Name, doc.Issuer, p.config.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, fmt.Errorf("provider %s is missing an authorization, token or jwks endpoint", p.Name)
+	}
+
+	p.mu.Lock()
+	p.discovery = &doc
+	p.mu.Unlock()
+	return &doc, nil
+}
+
+// AuthCodeURL returns the URL sending the user to the provider, challenge is
+// the S256 PKCE challenge of the verifier given to Exchange
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, challenge string) (string, error) {
+	doc, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {strings.Join(p.config.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(doc.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return doc.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange trades the authorization code for the raw ID token
+func (p *Provider) Exchange(ctx context.Context, code, verifier string) (string, error) {
+	doc, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"code_verifier": {verifier},
+		"client_id":     {p.config.ClientID},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, doc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	// client_secret_basic, public clients only send their id
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("could not reach provider %s: %v", p.Name, err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return "", fmt.Errorf("invalid token response from provider %s: %v", p.Name, err)
+	}
+	if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized {
+		return "", fmt.Errorf("%w: %s %s", ErrCodeRejected, body.Error, body.ErrorDescription)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("provider %s answered %d to the token request", p.Name, resp.StatusCode)
+	}
+	if body.IDToken == "" {
+		return "", fmt.Errorf("%w: provider %s returned no id token", ErrInvalidIDToken, p.Name)
+	}
+	return body.IDToken, nil
+}
+
+// key returns the provider key named kid, the keys are fetched again when kid
+// is unknown so rotated keys are picked up
+func (p *Provider) key(ctx context.Context, kid string) (utils.JWK, error) {
+	p.mu.Lock()
+	key, ok := lookupKey(p.keys, kid)
+	stale := time.Since(p.keysAt) >= jwksRefreshInterval
+	p.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+	if !stale {
+		return utils.JWK{}, fmt.Errorf("%w: unknown key id %q", ErrInvalidIDToken, kid)
+	}
+
+	doc, err := p.metadata(ctx)
+	if err != nil {
+		return utils.JWK{}, err
+	}
+	var jwks utils.JWKS
+	if err := p.getJSON(ctx, doc.JWKSURI, &jwks); err != nil {
+		return utils.JWK{}, fmt.Errorf("could not fetch the keys of provider %s: %v", p.Name, err)
+	}
+	keys := map[string]utils.JWK{}
+	for _, key := range jwks.Keys {
+		// Encryption keys cannot verify signatures
+		if key.Use == "" || key.Use == "sig" {
+			keys[key.Kid] = key
+		}
+	}
+
+	p.mu.Lock()
+	p.keys, p.keysAt = keys, time.Now()
+	p.mu.Unlock()
+
+	if key, ok := lookupKey(keys, kid); ok {
+		return key, nil
+	}
+	return utils.JWK{}, fmt.Errorf("%w: unknown key id %q", ErrInvalidIDToken, kid)
+}
+
+// lookupKey finds kid in keys, tokens without kid need a single key
+func lookupKey(keys map[string]utils.JWK, kid string) (utils.JWK, bool) {
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, true
+		}
+	}
+	key, ok := keys[kid]
+	return key, ok
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// NewPKCE returns a random code verifier and its S256 challenge
+func NewPKCE() (verifier, challenge string, err error) {
+	verifier, err = utils.GenerateRandomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	return verifier, S256Challenge(verifier), nil
+}
+
+// S256Challenge returns the PKCE challenge of verifier
+func S256Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
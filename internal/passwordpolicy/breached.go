@@ -0,0 +1,76 @@
+package passwordpolicy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// BreachedList holds the SHA-1 hashes of breached passwords, sorted for a
+// binary search
+type BreachedList struct {
+	hashes [][sha1.Size]byte
+}
+
+// LoadBreached reads a file with one hex SHA-1 hash per line, optionally
+// followed by ":count" as in the Have I Been Pwned downloads. Empty lines and
+// lines starting with # are skipped.
+func LoadBreached(path string) (*BreachedList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open breached passwords file: %v", err)
+	}
+	defer file.Close()
+
+	list := &BreachedList{}
+	sorted := true
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		hexHash, _, _ := strings.Cut(text, ":")
+
+		var hash [sha1.Size]byte
+		if len(hexHash) != 2*sha1.Size {
+			return nil, fmt.Errorf("invalid SHA-1 hash on line %d of %s", line, path)
+		}
+		if _, err := hex.Decode(hash[:], []byte(hexHash)); err != nil {
+			return nil, fmt.Errorf("invalid SHA-1 hash on line %d of %s", line, path)
+		}
+		if count := len(list.hashes); count > 0 && bytes.Compare(list.hashes[count-1][:], hash[:]) > 0 {
+			sorted = false
+		}
+		list.hashes = append(list.hashes, hash)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read breached passwords file: %v", err)
+	}
+
+	if !sorted {
+		sort.Slice(list.hashes, func(i, j int) bool {
+			return bytes.Compare(list.hashes[i][:], list.hashes[j][:]) < 0
+		})
+	}
+	return list, nil
+}
+
+// Len returns the number of hashes in the list
+func (l *BreachedList) Len() int {
+	return len(l.hashes)
+}
+
+// Contains reports whether password is in the list
+func (l *BreachedList) Contains(password string) bool {
+	hash := sha1.Sum([]byte(password))
+	i := sort.Search(len(l.hashes), func(i int) bool {
+		return bytes.Compare(l.hashes[i][:], hash[:]) >= 0
+	})
+	return i < len(l.hashes) && l.hashes[i] == hash
+}
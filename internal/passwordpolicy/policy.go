@@ -0,0 +1,113 @@
+package passwordpolicy
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/0xSumeet/go_api/internal/configs"
+)
+
+// Violation codes returned by Check
+const (
+	CodeTooShort         string = "too_short"
+	CodeTooLong          string = "too_long"
+	CodeMissingLowercase string = "missing_lowercase"
+	CodeMissingUppercase string = "missing_uppercase"
+	CodeMissingDigit     string = "missing_digit"
+	CodeMissingSymbol    string = "missing_symbol"
+	CodeContainsUserInfo string = "contains_user_info"
+	CodeBreachedPassword string = "breached"
+)
+
+// minUserInfoPartLength ignores the short words of the email and name
+const minUserInfoPartLength = 3
+
+// Violation is a rule of the policy a password breaks
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Policy checks the passwords chosen at signup, password change and reset
+type Policy struct {
+	cfg      config.PasswordPolicy
+	breached *BreachedList
+}
+
+// New returns the policy of cfg, breached may be nil to skip the breached check
+func New(cfg config.PasswordPolicy, breached *BreachedList) *Policy {
+	return &Policy{cfg: cfg, breached: breached}
+}
+
+// Check returns the violations of password for the account with email and name,
+// none when it is accepted
+func (p *Policy) Check(password, email, name string) []Violation {
+	violations := []Violation{}
+	add := func(code, format string, args ...any) {
+		violations = append(violations, Violation{Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	length := utf8.RuneCountInString(password)
+	if length < p.cfg.MinLength {
+		add(CodeTooShort, "must be at least %d characters", p.cfg.MinLength)
+	}
+	if p.cfg.MaxLength > 0 && length > p.cfg.MaxLength {
+		add(CodeTooLong, "must be at most %d characters", p.cfg.MaxLength)
+	}
+
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		case !unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	if p.cfg.RequireLowercase && !lower {
+		add(CodeMissingLowercase, "must contain a lowercase letter")
+	}
+	if p.cfg.RequireUppercase && !upper {
+		add(CodeMissingUppercase, "must contain an uppercase letter")
+	}
+	if p.cfg.RequireDigit && !digit {
+		add(CodeMissingDigit, "must contain a digit")
+	}
+	if p.cfg.RequireSymbol && !symbol {
+		add(CodeMissingSymbol, "must contain a symbol")
+	}
+
+	if p.cfg.DisallowUserInfo && containsUserInfo(password, email, name) {
+		add(CodeContainsUserInfo, "must not contain your email or name")
+	}
+
+	if p.breached != nil && p.breached.Contains(password) {
+		add(CodeBreachedPassword, "appears in a list of breached passwords, choose another one")
+	}
+	return violations
+}
+
+// containsUserInfo reports whether password contains the local part of email,
+// or one of its words or the words of name, ignoring case and short words
+func containsUserInfo(password, email, name string) bool {
+	password = strings.ToLower(password)
+	local, _, _ := strings.Cut(strings.ToLower(email), "@")
+
+	parts := []string{local}
+	notAlphanumeric := func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }
+	parts = append(parts, strings.FieldsFunc(local, notAlphanumeric)...)
+	parts = append(parts, strings.FieldsFunc(strings.ToLower(name), notAlphanumeric)...)
+
+	for _, part := range parts {
+		if utf8.RuneCountInString(part) >= minUserInfoPartLength && strings.Contains(password, part) {
+			return true
+		}
+	}
+	return false
+}
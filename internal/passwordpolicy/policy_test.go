@@ -0,0 +1,124 @@
+package passwordpolicy
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/0xSumeet/go_api/internal/configs"
+)
+
+// writeBreached writes a breached list of passwords, in the given order, with
+// the counts and comments of the downloaded lists
+func writeBreached(t *testing.T, passwords ...string) string {
+	t.Helper()
+	lines := []string{"# breached passwords", ""}
+	for _, password := range passwords {
+		hash := sha1.Sum([]byte(password))
+		lines = append(lines, strings.ToUpper(hex.EncodeToString(hash[:]))+":42")
+	}
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func codes(violations []Violation) []string {
+	codes := []string{}
+	for _, violation := range violations {
+		codes = append(codes, violation.Code)
+	}
+	return codes
+}
+
+func TestCheck(t *testing.T) {
+	breached, err := LoadBreached(writeBreached(t, "password123", "letmein!", "correct horse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaults := config.PasswordPolicy{MinLength: 8, MaxLength: 16, DisallowUserInfo: true}
+	classes := config.PasswordPolicy{RequireLowercase: true, RequireUppercase: true, RequireDigit: true, RequireSymbol: true}
+
+	tests := []struct {
+		name     string
+		cfg      config.PasswordPolicy
+		password string
+		codes    []string
+	}{
+		{"accepted", defaults, "plum tree river", []string{}},
+		{"too short", defaults, "plum", []string{CodeTooShort}},
+		{"minimum length", defaults, "plumtree", []string{}},
+		// Lengths count characters, not bytes
+		{"multibyte characters", defaults, "éééééééé", []string{}},
+		{"too long", defaults, strings.Repeat("plum", 5), []string{CodeTooLong}},
+		{"no maximum", config.PasswordPolicy{MinLength: 8}, strings.Repeat("plum", 50), []string{}},
+		{"breached", defaults, "password123", []string{CodeBreachedPassword}},
+		{"breached is case sensitive", defaults, "Password123", []string{}},
+		{"email local part", defaults, "xxAda.Lovelacexx", []string{CodeContainsUserInfo}},
+		{"word of the email", defaults, "lovelace2024", []string{CodeContainsUserInfo}},
+		{"word of the name", defaults, "my BYRON poem", []string{CodeContainsUserInfo}},
+		{"short words are ignored", defaults, "al plum tree", []string{}},
+		{"domain is ignored", defaults, "example river", []string{}},
+		{"user info allowed", config.PasswordPolicy{MinLength: 8}, "lovelace2024", []string{}},
+		{"character classes", classes, "Plum-tree9", []string{}},
+		{
+			"missing classes",
+			classes,
+			"plum tree",
+			[]string{CodeMissingUppercase, CodeMissingDigit, CodeMissingSymbol},
+		},
+		{"every violation", defaults, "byron", []string{CodeTooShort, CodeContainsUserInfo}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			violations := New(test.cfg, breached).Check(test.password, "ada.lovelace@example.com", "Augusta Al Byron")
+			if got := codes(violations); !reflect.DeepEqual(got, test.codes) {
+				t.Errorf("got %v, want %v", got, test.codes)
+			}
+			for _, violation := range violations {
+				if violation.Message == "" {
+					t.Errorf("violation %s has no message", violation.Code)
+				}
+			}
+		})
+	}
+
+	if got := codes(New(defaults, nil).Check("password123", "", "")); len(got) != 0 {
+		t.Errorf("without a breached list: got %v", got)
+	}
+}
+
+func TestLoadBreached(t *testing.T) {
+	// The downloaded lists are sorted, a list out of order must still be searchable
+	list, err := LoadBreached(writeBreached(t, "zebra", "apple", "mango", "kiwi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Len() != 4 {
+		t.Errorf("got %d hashes, want 4", list.Len())
+	}
+	for _, password := range []string{"zebra", "apple", "mango", "kiwi"} {
+		if !list.Contains(password) {
+			t.Errorf("%q not found", password)
+		}
+	}
+	if list.Contains("banana") {
+		t.Error("banana found")
+	}
+
+	invalid := filepath.Join(t.TempDir(), "invalid.txt")
+	if err := os.WriteFile(invalid, []byte("# list\nnot a hash\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadBreached(invalid); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("got error %v, want the invalid line", err)
+	}
+	if _, err := LoadBreached(invalid + ".missing"); err == nil {
+		t.Error("loaded a missing file")
+	}
+}
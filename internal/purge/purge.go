@@ -0,0 +1,32 @@
+// Package purge removes the deleted products once they can no longer be restored
+package purge
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/0xSumeet/go_api/internal/database"
+)
+
+// Run removes the products deleted more than after ago, now and then every
+// interval, until ctx is done. Running it on several servers is harmless.
+func Run(ctx context.Context, products database.ProductRepository, after, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := products.PurgeDeletedProducts(ctx, time.Now().Add(-after))
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Error purging deleted products: %s", err)
+		} else if purged > 0 {
+			log.Printf("Purged %d products deleted more than %s ago", purged, after)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
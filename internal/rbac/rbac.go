@@ -0,0 +1,78 @@
+package rbac
+
+import "sort"
+
+// Roles stored per user in the user_roles table
+const (
+	RoleAdmin          string = "admin"
+	RoleCatalogManager string = "catalog_manager"
+	RoleCustomer       string = "customer"
+)
+
+// Permissions checked by auth.RequirePermission
+const (
+	PermProductsRead   string = "products:read"
+	PermProductsWrite  string = "products:write"
+	PermRolesManage    string = "roles:manage"
+	PermUsersManage    string = "users:manage"
+	PermAPIKeysManage  string = "api_keys:manage"
+	PermProductsManage string = "products:manage"
+)
+
+// DefaultRole is granted to every new account
+const DefaultRole = RoleCustomer
+
+var rolePermissions = map[string][]string{
+	RoleAdmin:          {PermProductsRead, PermProductsWrite, PermProductsManage, PermRolesManage, PermUsersManage, PermAPIKeysManage},
+	RoleCatalogManager: {PermProductsRead, PermProductsWrite},
+	RoleCustomer:       {PermProductsRead},
+}
+
+// apiKeyScopes are the permissions an API key can be granted, account and admin
+// endpoints need a login
+var apiKeyScopes = []string{PermProductsRead, PermProductsWrite}
+
+// IsAPIKeyScope reports whether an API key can be granted scope
+func IsAPIKeyScope(scope string) bool {
+	for _, allowed := range apiKeyScopes {
+		if allowed == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValidRole reports whether role is known
+func IsValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// Permissions returns the sorted permissions granted by roles, unknown roles grant nothing
+func Permissions(roles []string) []string {
+	set := map[string]bool{}
+	for _, role := range roles {
+		for _, permission := range rolePermissions[role] {
+			set[permission] = true
+		}
+	}
+
+	permissions := make([]string, 0, len(set))
+	for permission := range set {
+		permissions = append(permissions, permission)
+	}
+	sort.Strings(permissions)
+	return permissions
+}
+
+// HasPermission reports whether one of roles grants permission
+func HasPermission(roles []string, permission string) bool {
+	for _, role := range roles {
+		for _, granted := range rolePermissions[role] {
+			if granted == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
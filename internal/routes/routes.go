@@ -3,21 +3,95 @@ package routes
 import (
 	"github.com/0xSumeet/go_api/internal/handlers"
 	"github.com/0xSumeet/go_api/internal/middleware"
+	"github.com/0xSumeet/go_api/internal/rbac"
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRoutes(c *gin.Engine) {
-	c.GET("/home", handlers.Home)
-	c.POST("/signup", handlers.SignUpTry)
-	c.POST("/login", handlers.Login)
-	c.POST("/register-product", handlers.AddProduct)
-	c.PUT("/update-product/:id", handlers.UpdateProduct)
+func SetupRoutes(c *gin.Engine, h *handlers.Handler) {
+	authenticate := auth.AuthMiddleware(h.Keys, h.Store, h.Config.TokenIssuer(), h.Config.Auth.Audience)
+
+	c.GET("/home", h.Home)
+	c.GET("/healthz", h.Healthz)
+	c.GET("/readyz", h.Readyz)
+	c.GET("/.well-known/jwks.json", h.JWKS)
+	c.POST("/signup", h.SignUpTry)
+	c.POST("/login", h.Login)
+	c.POST("/login/2fa", h.LoginTwoFactor)
+	c.POST("/login/magic", h.RequestMagicLink)
+	c.POST("/login/magic/redeem", h.RedeemMagicLink)
+	c.POST("/login/oidc/:provider", h.StartOIDCLogin)
+	c.POST("/login/oidc/:provider/callback", h.FinishOIDCLogin)
+	c.POST("/token/refresh", h.RefreshToken)
+	c.POST("/logout", authenticate, auth.RequireLogin(), h.Logout)
+	c.POST("/password/forgot", h.ForgotPassword)
+	c.POST("/password/reset", h.ResetPassword)
+	c.GET("/verify-email", h.VerifyEmail)
+	c.POST("/verify-email/resend", h.ResendVerification)
+
+	// Catalog writes need the products:write permission and a verified email
+	canWriteProducts := auth.RequirePermission(rbac.PermProductsWrite)
+	verified := auth.RequireVerifiedEmail()
+	c.POST("/register-product", authenticate, canWriteProducts, verified, h.AddProduct)
+	c.PUT("/update-product/:id", authenticate, canWriteProducts, verified, h.UpdateProduct)
+	c.PATCH("/products/:id", authenticate, canWriteProducts, verified, h.PatchProduct)
+	c.DELETE("/products/:id", authenticate, canWriteProducts, verified, h.DeleteProduct)
 
 	// Auth Protected routes
-	authorized := c.Group("/secure", auth.AuthMiddleware())
+	authorized := c.Group("/secure", authenticate)
+	{
+		canReadProducts := auth.RequirePermission(rbac.PermProductsRead)
+		authorized.GET("/products", canReadProducts, h.GetProductsByLimit)
+		authorized.GET("/product/:id", canReadProducts, h.GetProductById)
+	}
+
+	// Account routes are refused to API keys
+	account := c.Group("/secure", authenticate, auth.RequireLogin())
+	{
+		account.GET("/me", h.GetMe)
+		account.PATCH("/me", h.UpdateMe)
+		account.DELETE("/me", h.DeleteMe)
+		account.GET("/me/sessions", h.ListSessions)
+		account.DELETE("/me/sessions", h.RevokeOtherSessions)
+		account.DELETE("/me/sessions/:id", h.RevokeSession)
+		account.GET("/me/identities", h.ListIdentities)
+		account.DELETE("/me/identities/:id", h.UnlinkIdentity)
+
+		account.POST("/2fa/totp", h.SetupTOTP)
+		account.POST("/2fa/totp/confirm", h.ConfirmTOTP)
+		account.DELETE("/2fa/totp", h.DisableTOTP)
+		account.POST("/2fa/recovery-codes", h.RegenerateRecoveryCodes)
+
+		account.GET("/api-keys", h.ListAPIKeys)
+		account.POST("/api-keys", h.CreateAPIKey)
+		account.DELETE("/api-keys/:id", h.RevokeAPIKey)
+	}
+
+	// Admin routes
+	admin := c.Group("/admin", authenticate, auth.RequirePermission(rbac.PermRolesManage))
+	{
+		admin.GET("/users/:id/roles", h.GetUserRoles)
+		admin.POST("/users/:id/roles", h.GrantRole)
+		admin.DELETE("/users/:id/roles/:role", h.RevokeRole)
+	}
+
+	users := c.Group("/admin/users", authenticate, auth.RequirePermission(rbac.PermUsersManage))
+	{
+		users.GET("/:id/login-attempts", h.GetLoginAttempts)
+		users.POST("/:id/unlock", h.UnlockUser)
+	}
+
+	products := c.Group("/admin/products", authenticate, auth.RequirePermission(rbac.PermProductsManage))
+	{
+		products.GET("/deleted", h.GetDeletedProducts)
+		products.POST("/:id/restore", h.RestoreProduct)
+		products.DELETE("/:id", h.PurgeProduct)
+	}
+
+	apiKeys := c.Group("/admin/api-keys", authenticate, auth.RequireLogin(), auth.RequirePermission(rbac.PermAPIKeysManage))
 	{
-		authorized.GET("/products", handlers.GetProductsByLimit)
-		authorized.GET("/product/:id", handlers.GetProductById)
+		apiKeys.GET("", h.ListServiceAPIKeys)
+		apiKeys.POST("", h.CreateServiceAPIKey)
+		apiKeys.DELETE("/:id", h.RevokeAnyAPIKey)
 	}
 
 	// c.GET("/users", handlers.GetUsers)
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/0xSumeet/go_api/internal/configs"
+)
+
+// Server wraps http.Server with the lifecycle expected during rolling deploys:
+// on SIGINT or SIGTERM readiness fails first, then connections are drained
+type Server struct {
+	http            *http.Server
+	ready           atomic.Bool
+	shutdownDelay   time.Duration
+	shutdownTimeout time.Duration
+}
+
+func New(addr string, cfg config.Server, handler http.Handler) *Server {
+	return &Server{
+		http: &http.Server{
+			Addr:         addr,
+			Handler:      handler,
+			ReadTimeout:  cfg.ReadTimeout.Duration,
+			WriteTimeout: cfg.WriteTimeout.Duration,
+			IdleTimeout:  cfg.IdleTimeout.Duration,
+		},
+		shutdownDelay:   cfg.ShutdownDelay.Duration,
+		shutdownTimeout: cfg.ShutdownTimeout.Duration,
+	}
+}
+
+// Ready reports whether the server accepts new traffic
+func (s *Server) Ready() bool {
+	return s.ready.Load()
+}
+
+// Run serves until ctx is cancelled or a SIGINT/SIGTERM is received, then shuts
+// down gracefully. A second signal stops waiting for the in-flight requests.
+func (s *Server) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.http.Addr)
+	if err != nil {
+		return fmt.Errorf("could not listen on %s: %v", s.http.Addr, err)
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- s.http.Serve(listener)
+	}()
+	s.ready.Store(true)
+	log.Printf("Listening on %s", listener.Addr())
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case err := <-serveErr:
+		s.ready.Store(false)
+		return err
+	case sig := <-signals:
+		log.Printf("Received %s, shutting down", sig)
+	case <-ctx.Done():
+		log.Printf("Shutting down")
+	}
+
+	// Fail readiness first and give the load balancer time to notice it
+	s.ready.Store(false)
+	select {
+	case <-time.After(s.shutdownDelay):
+	case <-signals:
+		return s.http.Close()
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+
+	// Drain the in-flight requests, a second signal forces the shutdown
+	go func() {
+		select {
+		case <-signals:
+			log.Printf("Forcing shutdown")
+			cancel()
+		case <-shutdownCtx.Done():
+		}
+	}()
+
+	if err := s.http.Shutdown(shutdownCtx); err != nil {
+		s.http.Close()
+		return fmt.Errorf("could not drain connections: %v", err)
+	}
+
+	if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	log.Printf("Server stopped")
+	return nil
+}
@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+// APIKeyPrefix starts every API key, so leaked keys are easy to recognize
+const APIKeyPrefix = "goapi_"
+
+// GenerateAPIKey returns a new key goapi_<prefix>_<secret> for the client, its
+// public prefix and the hash to store
+func GenerateAPIKey() (string, string, string, error) {
+	buf := make([]byte, 6)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", "", err
+	}
+	prefix := hex.EncodeToString(buf)
+
+	secret, err := GenerateRandomString(32)
+	if err != nil {
+		return "", "", "", err
+	}
+	key := APIKeyPrefix + prefix + "_" + secret
+	return key, prefix, HashToken(key), nil
+}
+
+// ParseAPIKeyPrefix returns the public prefix of key
+func ParseAPIKeyPrefix(key string) (string, bool) {
+	if !strings.HasPrefix(key, APIKeyPrefix) {
+		return "", false
+	}
+	prefix, secret, ok := strings.Cut(strings.TrimPrefix(key, APIKeyPrefix), "_")
+	if !ok || prefix == "" || secret == "" {
+		return "", false
+	}
+	return prefix, true
+}
@@ -1,29 +1,211 @@
 package utils
 
 import (
-  "fmt"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/0xSumeet/go_api/internal/configs"
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
-  "github.com/0xSumeet/go_api/internal/database"
 )
 
-// Generate Password hash
-func GenerateHash(password string) (string, error) {
-  var user database.User
-  var err error
-  hash, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)  
-  if err != nil {
-    return "", err 
-  }
-  return string(hash), nil
+// Password hashing algorithms of config.PasswordHashing
+const (
+	AlgorithmArgon2id string = "argon2id"
+	AlgorithmBcrypt   string = "bcrypt"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// PasswordHasher hashes passwords in an encoded format recording the algorithm
+// and its parameters
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify reports whether password matches encoded, a hash this hasher recognizes
+	Verify(encoded, password string) (bool, error)
+	// Recognizes reports whether encoded was produced by this algorithm
+	Recognizes(encoded string) bool
+	// NeedsRehash reports whether encoded used other parameters than the hasher
+	NeedsRehash(encoded string) bool
+}
+
+// Passwords hashes new passwords with the configured algorithm and verifies the
+// hashes of every supported one
+type Passwords struct {
+	current PasswordHasher
+	hashers []PasswordHasher
+
+	// dummy is the hash of a random password, see VerifyDummy
+	dummyOnce sync.Once
+	dummy     string
 }
 
-// Compare user input password with the hash password from the database
-func CompareHashPasswords(hash string, userpassword string) (bool, error) {
-	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(userpassword)); err != nil {
-		return false, fmt.Errorf("invalid password")
+// NewPasswords returns the hashers of cfg, the config must be validated
+func NewPasswords(cfg config.PasswordHashing) *Passwords {
+	argon := &Argon2idHasher{
+		Memory:      uint32(cfg.Argon2Memory),
+		Iterations:  uint32(cfg.Argon2Iterations),
+		Parallelism: uint8(cfg.Argon2Parallelism),
 	}
-	return true, nil
+	bcryptHasher := &BcryptHasher{Cost: cfg.BcryptCost}
+
+	passwords := &Passwords{current: argon, hashers: []PasswordHasher{argon, bcryptHasher}}
+	if cfg.Algorithm == AlgorithmBcrypt {
+		passwords.current = bcryptHasher
+	}
+	return passwords
+}
+
+// Hash hashes a new password with the configured algorithm
+func (p *Passwords) Hash(password string) (string, error) {
+	return p.current.Hash(password)
+}
+
+// Verify checks password against the stored hash, rehash reports whether the
+// hash should be replaced by Hash(password) because its algorithm or parameters
+// are outdated
+func (p *Passwords) Verify(encoded, password string) (ok bool, rehash bool, err error) {
+	for _, hasher := range p.hashers {
+		if !hasher.Recognizes(encoded) {
+			continue
+		}
+		ok, err := hasher.Verify(encoded, password)
+		if err != nil || !ok {
+			return false, false, err
+		}
+		return true, hasher != p.current || hasher.NeedsRehash(encoded), nil
+	}
+	return false, false, fmt.Errorf("unknown password hash format")
+}
+
+// VerifyDummy verifies password against the hash of a random password, so
+// checking the password of an unknown user takes as long as for a known one
+func (p *Passwords) VerifyDummy(password string) {
+	p.dummyOnce.Do(func() {
+		random, err := GenerateRandomString(32)
+		if err == nil {
+			p.dummy, _ = p.current.Hash(random)
+		}
+	})
+	if p.dummy != "" {
+		p.current.Verify(p.dummy, password)
+	}
+}
+
+// Argon2idHasher encodes hashes as $argon2id$v=19$m=65536,t=3,p=4$<salt>$<key>
+type Argon2idHasher struct {
+	// Memory is in KiB
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+type argon2Hash struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+func (a *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, a.Iterations, a.Memory, a.Parallelism, argon2KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, a.Memory, a.Iterations, a.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (a *Argon2idHasher) Verify(encoded, password string) (bool, error) {
+	hash, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+	key := argon2.IDKey([]byte(password), hash.salt, hash.iterations, hash.memory, hash.parallelism, uint32(len(hash.key)))
+	return subtle.ConstantTimeCompare(key, hash.key) == 1, nil
+}
+
+func (a *Argon2idHasher) Recognizes(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+func (a *Argon2idHasher) NeedsRehash(encoded string) bool {
+	hash, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return hash.memory != a.Memory || hash.iterations != a.Iterations || hash.parallelism != a.Parallelism ||
+		len(hash.salt) != argon2SaltLength || len(hash.key) != argon2KeyLength
+}
+
+func decodeArgon2id(encoded string) (*argon2Hash, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, fmt.Errorf("invalid argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, fmt.Errorf("unsupported argon2id version")
+	}
+
+	var hash argon2Hash
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &hash.memory, &hash.iterations, &hash.parallelism); err != nil {
+		return nil, fmt.Errorf("invalid argon2id parameters: %v", err)
+	}
+	if hash.iterations == 0 || hash.parallelism == 0 {
+		return nil, fmt.Errorf("invalid argon2id parameters")
+	}
+
+	var err error
+	if hash.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, fmt.Errorf("invalid argon2id salt: %v", err)
+	}
+	if hash.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(hash.key) == 0 {
+		return nil, fmt.Errorf("invalid argon2id key")
+	}
+	return &hash, nil
+}
+
+// BcryptHasher verifies the hashes stored before argon2id, it can also hash new
+// passwords when configured
+type BcryptHasher struct {
+	Cost int
+}
+
+func (b *BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
 }
 
+func (b *BcryptHasher) Verify(encoded, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
 
+func (b *BcryptHasher) Recognizes(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
 
+func (b *BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != b.Cost
+}
@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/0xSumeet/go_api/internal/configs"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// cheapHashing keeps the tests fast, the parameters are those of the hashes
+func cheapHashing(algorithm string) config.PasswordHashing {
+	return config.PasswordHashing{
+		Algorithm:         algorithm,
+		Argon2Memory:      1024,
+		Argon2Iterations:  1,
+		Argon2Parallelism: 1,
+		BcryptCost:        bcrypt.MinCost,
+	}
+}
+
+func TestArgon2idEncoding(t *testing.T) {
+	hasher := &Argon2idHasher{Memory: 1024, Iterations: 2, Parallelism: 3}
+	encoded, err := hasher.Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=1024,t=2,p=3$") {
+		t.Errorf("got %q", encoded)
+	}
+
+	hash, err := decodeArgon2id(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash.memory != 1024 || hash.iterations != 2 || hash.parallelism != 3 ||
+		len(hash.salt) != argon2SaltLength || len(hash.key) != argon2KeyLength {
+		t.Errorf("decoded %+v", hash)
+	}
+
+	other, _ := hasher.Hash("secret")
+	if other == encoded {
+		t.Error("two hashes of a password share their salt")
+	}
+}
+
+func TestPasswordsVerify(t *testing.T) {
+	argon := NewPasswords(cheapHashing(AlgorithmArgon2id))
+	bcryptHashed := NewPasswords(cheapHashing(AlgorithmBcrypt))
+
+	hash := func(passwords *Passwords) string {
+		encoded, err := passwords.Hash("secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return encoded
+	}
+	argonHash, bcryptHash := hash(argon), hash(bcryptHashed)
+	moreMemory := cheapHashing(AlgorithmArgon2id)
+	moreMemory.Argon2Memory = 2048
+	moreIterations := cheapHashing(AlgorithmArgon2id)
+	moreIterations.Argon2Iterations = 2
+	higherCost := cheapHashing(AlgorithmBcrypt)
+	higherCost.BcryptCost = bcrypt.MinCost + 1
+	empty, err := argon.Hash("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		passwords *Passwords
+		encoded   string
+		password  string
+		ok        bool
+		rehash    bool
+		err       bool
+	}{
+		{"argon2id", argon, argonHash, "secret", true, false, false},
+		{"argon2id wrong password", argon, argonHash, "Secret", false, false, false},
+		{"argon2id memory changed", NewPasswords(moreMemory), argonHash, "secret", true, true, false},
+		{"argon2id iterations changed", NewPasswords(moreIterations), argonHash, "secret", true, true, false},
+		{"argon2id wrong password and parameters changed", NewPasswords(moreMemory), argonHash, "Secret", false, false, false},
+		// Hashes made before argon2id keep working and are upgraded
+		{"bcrypt fallback", argon, bcryptHash, "secret", true, true, false},
+		{"bcrypt fallback wrong password", argon, bcryptHash, "Secret", false, false, false},
+		{"bcrypt", bcryptHashed, bcryptHash, "secret", true, false, false},
+		{"bcrypt cost changed", NewPasswords(higherCost), bcryptHash, "secret", true, true, false},
+		{"argon2id with bcrypt configured", bcryptHashed, argonHash, "secret", true, true, false},
+		{"empty password", argon, empty, "", true, false, false},
+		{"not the empty password", argon, empty, "secret", false, false, false},
+		{"unknown format", argon, "secret", "secret", false, false, true},
+		{"corrupted argon2id", argon, "$argon2id$v=19$m=1024,t=1,p=1$salt", "secret", false, false, true},
+		{"other argon2id version", argon, strings.Replace(argonHash, "v=19", "v=16", 1), "secret", false, false, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ok, rehash, err := test.passwords.Verify(test.encoded, test.password)
+			if (err != nil) != test.err {
+				t.Fatalf("got error %v", err)
+			}
+			if ok != test.ok || rehash != test.rehash {
+				t.Errorf("got ok %v and rehash %v, want %v and %v", ok, rehash, test.ok, test.rehash)
+			}
+		})
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	hasher := &Argon2idHasher{Memory: 1024, Iterations: 1, Parallelism: 1}
+	encoded, err := hasher.Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		hasher  PasswordHasher
+		encoded string
+		rehash  bool
+	}{
+		{"same parameters", hasher, encoded, false},
+		{"memory", &Argon2idHasher{Memory: 2048, Iterations: 1, Parallelism: 1}, encoded, true},
+		{"iterations", &Argon2idHasher{Memory: 1024, Iterations: 2, Parallelism: 1}, encoded, true},
+		{"parallelism", &Argon2idHasher{Memory: 1024, Iterations: 1, Parallelism: 2}, encoded, true},
+		{"short key", hasher, encoded[:len(encoded)-8], true},
+		{"malformed", hasher, "$argon2id$", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.hasher.NeedsRehash(test.encoded); got != test.rehash {
+				t.Errorf("got %v, want %v", got, test.rehash)
+			}
+		})
+	}
+}
@@ -1,39 +1,90 @@
 package utils
 
 import (
+	"fmt"
+	"strconv"
 	"time"
 
-	"github.com/0xSumeet/go_api/internal/configs"
-
 	"github.com/dgrijalva/jwt-go"
 )
 
-// JWT Claims structure
+// JWT Claims structure, the user is identified by its id in the subject
 type Claims struct {
-	Username string `json:"username"`
+	Roles         []string `json:"roles"`
+	EmailVerified bool     `json:"email_verified"`
+	// AMR lists the authentication methods of the session login
+	AMR []string `json:"amr,omitempty"`
+	// SessionID is the login session of the token, revoked sessions end their tokens
+	SessionID string `json:"sid,omitempty"`
 	jwt.StandardClaims
 }
 
-// Generate token
-func GenerateJWT(username string) (string, error) {
-	// Define expiration time of the token
-	expirationTime := time.Now().Add(5 * time.Minute)
+// Authentication methods of the amr claim, RFC 8176 has no value for the
+// magic links and the OpenID Connect logins
+const (
+	AMRPassword  string = "pwd"
+	AMROTP       string = "otp"
+	AMRMagicLink string = "email"
+	AMRFederated string = "fed"
+)
 
-	// Create claims, which includes the username and the expiry time
-	claims := &Claims{
-		Username: username,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expirationTime.Unix(),
-		},
+// UserID returns the user id of the subject
+func (c *Claims) UserID() (int, error) {
+	id, err := strconv.Atoi(c.Subject)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid subject %q", c.Subject)
 	}
+	return id, nil
+}
 
-	// Create the token with the specified claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+// Generate token for the user claims, the issuer and audience set in claims
+// are kept. The subject is the user id and the id a random jti used to revoke
+// the token.
+func GenerateJWT(keys *KeySet, userID int, claims Claims, ttl time.Duration) (string, error) {
+	now := time.Now()
 
-	// Sign the token with the secret key
-	tokenString, err := token.SignedString([]byte(config.JWTSecret))
+	jti, err := GenerateRandomString(16)
+	if err != nil {
+		return "", err
+	}
+
+	claims.Id = jti
+	claims.Subject = strconv.Itoa(userID)
+	claims.IssuedAt = now.Unix()
+	claims.NotBefore = now.Unix()
+	claims.ExpiresAt = now.Add(ttl).Unix()
+
+	// Sign the token with the current key of the key set
+	tokenString, err := keys.Sign(&claims)
 	if err != nil {
 		return "", err
 	}
 	return tokenString, nil
 }
+
+// ParseJWT verifies the token signature, its time claims, issuer and audience,
+// and returns its claims
+func ParseJWT(keys *KeySet, tokenString, issuer, audience string) (*Claims, error) {
+	claims := &Claims{}
+	if err := keys.Parse(tokenString, claims); err != nil {
+		return nil, err
+	}
+
+	// exp, iat and nbf are checked by Parse, the other claims are required
+	if claims.ExpiresAt == 0 || claims.IssuedAt == 0 || claims.NotBefore == 0 {
+		return nil, fmt.Errorf("token is missing exp, iat or nbf")
+	}
+	if !claims.VerifyIssuer(issuer, true) {
+		return nil, fmt.Errorf("invalid token issuer")
+	}
+	if !claims.VerifyAudience(audience, true) {
+		return nil, fmt.Errorf("invalid token audience")
+	}
+	if claims.Id == "" {
+		return nil, fmt.Errorf("token is missing jti")
+	}
+	if _, err := claims.UserID(); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
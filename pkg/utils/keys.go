@@ -0,0 +1,355 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/0xSumeet/go_api/internal/configs"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Key signs and verifies tokens, verification-only keys have no private key
+type Key struct {
+	ID        string
+	Method    jwt.SigningMethod
+	NotBefore time.Time
+	ExpiresAt time.Time
+
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+func (k *Key) canSign() bool {
+	return k.signKey != nil
+}
+
+// KeySet holds the keys used to sign and verify JWT tokens
+type KeySet struct {
+	keys []*Key
+	// maxTokenTTL is how long a replaced key keeps verifying
+	maxTokenTTL time.Duration
+	// now is the clock of the key set, time.Now when nil
+	now func() time.Time
+}
+
+// NewSecretKeySet returns a key set signing with HS256, tokens have no kid
+func NewSecretKeySet(secret string) *KeySet {
+	return &KeySet{keys: []*Key{{
+		Method:    jwt.SigningMethodHS256,
+		signKey:   []byte(secret),
+		verifyKey: []byte(secret),
+	}}}
+}
+
+// LoadKeySet loads the signing keys from their PEM files, one of them must be
+// allowed to sign now
+func LoadKeySet(configs []config.SigningKey, maxTokenTTL time.Duration) (*KeySet, error) {
+	set := &KeySet{maxTokenTTL: maxTokenTTL}
+	for _, cfg := range configs {
+		key, err := loadKey(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("could not load jwt key %q: %v", cfg.ID, err)
+		}
+		set.keys = append(set.keys, key)
+	}
+	sort.SliceStable(set.keys, func(i, j int) bool {
+		return set.keys[i].NotBefore.Before(set.keys[j].NotBefore)
+	})
+	if _, err := set.signingKey(set.clock()); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+func (s *KeySet) clock() time.Time {
+	if s.now != nil {
+		return s.now()
+	}
+	return time.Now()
+}
+
+func loadKey(cfg config.SigningKey) (*Key, error) {
+	key := &Key{ID: cfg.ID, NotBefore: cfg.NotBefore, ExpiresAt: cfg.ExpiresAt}
+
+	var public crypto.PublicKey
+	if cfg.PrivateKeyFile != "" {
+		private, err := readPrivateKey(cfg.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		key.signKey = private
+		public = private.Public()
+	} else {
+		var err error
+		public, err = readPublicKey(cfg.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The algorithm is inferred from the key type and must match when set
+	var method jwt.SigningMethod
+	switch k := public.(type) {
+	case *rsa.PublicKey:
+		method = jwt.SigningMethodRS256
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("only P-256 ecdsa keys are supported")
+		}
+		method = jwt.SigningMethodES256
+	case ed25519.PublicKey:
+		method = SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", public)
+	}
+	if cfg.Algorithm != "" && cfg.Algorithm != method.Alg() {
+		return nil, fmt.Errorf("key type does not match algorithm %s", cfg.Algorithm)
+	}
+
+	key.Method = method
+	key.verifyKey = public
+	return key, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not a PEM file", path)
+	}
+	return block, nil
+}
+
+func readPrivateKey(path string) (crypto.Signer, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", parsed)
+	}
+	return signer, nil
+}
+
+func readPublicKey(path string) (crypto.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type == "RSA PUBLIC KEY" {
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+// signingKey returns the most recent key allowed to sign at now
+func (s *KeySet) signingKey(now time.Time) (*Key, error) {
+	var current *Key
+	for _, key := range s.keys {
+		if key.canSign() && !now.Before(key.NotBefore) && !key.expired(now) {
+			current = key
+		}
+	}
+	if current == nil {
+		return nil, fmt.Errorf("no active jwt signing key")
+	}
+	return current, nil
+}
+
+func (k *Key) expired(now time.Time) bool {
+	return !k.ExpiresAt.IsZero() && !now.Before(k.ExpiresAt)
+}
+
+// verifies reports whether tokens signed by key are still accepted at now: keys
+// replaced by a newer signing key verify for one more token lifetime
+func (s *KeySet) verifies(key *Key, now time.Time) bool {
+	if key.expired(now) {
+		return false
+	}
+	if !key.canSign() || s.maxTokenTTL == 0 {
+		return true
+	}
+	for _, next := range s.keys {
+		if next != key && next.canSign() && next.NotBefore.After(key.NotBefore) && !now.Before(next.NotBefore) {
+			return now.Before(next.NotBefore.Add(s.maxTokenTTL))
+		}
+	}
+	return true
+}
+
+// Sign signs claims with the current signing key and sets its kid header
+func (s *KeySet) Sign(claims jwt.Claims) (string, error) {
+	key, err := s.signingKey(s.clock())
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	if key.ID != "" {
+		token.Header["kid"] = key.ID
+	}
+	return token.SignedString(key.signKey)
+}
+
+// Parse verifies tokenString with the key named by its kid header and fills claims
+func (s *KeySet) Parse(tokenString string, claims jwt.Claims) error {
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		now := s.clock()
+		for _, key := range s.keys {
+			if key.ID != kid {
+				continue
+			}
+			// The algorithm of the header must be the one of the key
+			if token.Method.Alg() != key.Method.Alg() || !s.verifies(key, now) {
+				return nil, jwt.ErrSignatureInvalid
+			}
+			return key.verifyKey, nil
+		}
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	})
+	if err != nil {
+		return err
+	}
+	if !token.Valid {
+		return fmt.Errorf("invalid token")
+	}
+	return nil
+}
+
+// JWK is the public part of a key, as published in the JWKS document
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys still verifying tokens and the upcoming ones, so
+// other services know a key before it starts signing. Secrets are never published.
+func (s *KeySet) JWKS() JWKS {
+	now := s.clock()
+	jwks := JWKS{Keys: []JWK{}}
+	for _, key := range s.keys {
+		if !s.verifies(key, now) {
+			continue
+		}
+
+		jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+		switch public := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = encodeBase64(public.N.Bytes())
+			jwk.E = encodeBase64(big.NewInt(int64(public.E)).Bytes())
+		case *ecdsa.PublicKey:
+			size := (public.Curve.Params().BitSize + 7) / 8
+			jwk.Kty = "EC"
+			jwk.Crv = public.Curve.Params().Name
+			jwk.X = encodeBase64(public.X.FillBytes(make([]byte, size)))
+			jwk.Y = encodeBase64(public.Y.FillBytes(make([]byte, size)))
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = encodeBase64(public)
+		default:
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	return jwks
+}
+
+func encodeBase64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// PublicKey decodes the key published by another issuer, as verified by the
+// jwt signing methods: RSA, EC P-256 or Ed25519
+func (k JWK) PublicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBase64Int(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBase64Int(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid RSA exponent of key %q", k.Kid)
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q of key %q", k.Crv, k.Kid)
+		}
+		x, err := decodeBase64Int(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBase64Int(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, fmt.Errorf("key %q is not on the P-256 curve", k.Kid)
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q of key %q", k.Crv, k.Kid)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key %q", k.Kid)
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q of key %q", k.Kty, k.Kid)
+}
+
+func decodeBase64Int(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, fmt.Errorf("invalid base64url integer in JWK")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
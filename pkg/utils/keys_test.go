@@ -0,0 +1,274 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0xSumeet/go_api/internal/configs"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// writeKeys writes the private and public PEM files of signer to dir
+func writeKeys(t *testing.T, dir, name string, signer crypto.Signer) (private, public string) {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	private = filepath.Join(dir, name+".pem")
+	if err := os.WriteFile(private, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	der, err = x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	public = filepath.Join(dir, name+".pub.pem")
+	if err := os.WriteFile(public, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return private, public
+}
+
+type testKeys struct {
+	rsa, ec, ed, p384   string
+	rsaPublic, edPublic string
+	signers             map[string]crypto.Signer
+}
+
+func newTestKeys(t *testing.T) testKeys {
+	t.Helper()
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var keys testKeys
+	keys.rsa, keys.rsaPublic = writeKeys(t, dir, "rsa", rsaKey)
+	keys.ec, _ = writeKeys(t, dir, "ec", ecKey)
+	keys.p384, _ = writeKeys(t, dir, "p384", p384Key)
+	keys.ed, keys.edPublic = writeKeys(t, dir, "ed", edKey)
+	keys.signers = map[string]crypto.Signer{"RS256": rsaKey, "ES256": ecKey, "EdDSA": edKey}
+	return keys
+}
+
+func TestLoadKeySet(t *testing.T) {
+	keys := newTestKeys(t)
+	tomorrow := time.Now().Add(24 * time.Hour)
+
+	tests := []struct {
+		name    string
+		configs []config.SigningKey
+		err     string
+	}{
+		{"rsa", []config.SigningKey{{ID: "a", PrivateKeyFile: keys.rsa}}, ""},
+		{"algorithm matching the key", []config.SigningKey{{ID: "a", Algorithm: "ES256", PrivateKeyFile: keys.ec}}, ""},
+		{"algorithm mismatch", []config.SigningKey{{ID: "a", Algorithm: "RS256", PrivateKeyFile: keys.ec}}, "does not match algorithm RS256"},
+		{"unsupported curve", []config.SigningKey{{ID: "a", PrivateKeyFile: keys.p384}}, "only P-256"},
+		{"missing file", []config.SigningKey{{ID: "a", PrivateKeyFile: keys.rsa + ".missing"}}, "no such file"},
+		{"public keys only", []config.SigningKey{{ID: "a", PublicKeyFile: keys.rsaPublic}}, "no active jwt signing key"},
+		{"upcoming key only", []config.SigningKey{{ID: "a", PrivateKeyFile: keys.ed, NotBefore: tomorrow}}, "no active jwt signing key"},
+		{
+			"public and upcoming keys with a signing key",
+			[]config.SigningKey{
+				{ID: "a", PublicKeyFile: keys.edPublic},
+				{ID: "b", PrivateKeyFile: keys.ec},
+				{ID: "c", PrivateKeyFile: keys.rsa, NotBefore: tomorrow},
+			},
+			"",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := LoadKeySet(test.configs, time.Hour)
+			if test.err == "" && err != nil {
+				t.Fatalf("got error %v", err)
+			}
+			if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Fatalf("got error %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+// rotation returns a key set where "old" signs until start and "new" after it
+func rotation(t *testing.T, keys testKeys, start time.Time, ttl time.Duration) *KeySet {
+	t.Helper()
+	set, err := LoadKeySet([]config.SigningKey{
+		{ID: "new", PrivateKeyFile: keys.ed, NotBefore: start},
+		{ID: "old", PrivateKeyFile: keys.ec, NotBefore: start.Add(-30 * 24 * time.Hour)},
+		{ID: "partner", PublicKeyFile: keys.rsaPublic},
+	}, ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return set
+}
+
+func kids(jwks JWKS) []string {
+	var kids []string
+	for _, key := range jwks.Keys {
+		kids = append(kids, key.Kid)
+	}
+	return kids
+}
+
+func TestKeySetRotation(t *testing.T) {
+	keys := newTestKeys(t)
+	start := time.Now().Add(time.Hour)
+	ttl := 15 * time.Minute
+	set := rotation(t, keys, start, ttl)
+
+	sign := func(at time.Time) (string, string) {
+		t.Helper()
+		set.now = func() time.Time { return at }
+		token, err := set.Sign(jwt.StandardClaims{Subject: "1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, _, err := new(jwt.Parser).ParseUnverified(token, &jwt.StandardClaims{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token, parsed.Header["kid"].(string)
+	}
+	verifies := func(token string, at time.Time) bool {
+		set.now = func() time.Time { return at }
+		return set.Parse(token, &jwt.StandardClaims{}) == nil
+	}
+
+	oldToken, kid := sign(start.Add(-time.Minute))
+	if kid != "old" {
+		t.Fatalf("signed with %q before the rotation, want old", kid)
+	}
+	if got := kids(set.JWKS()); !reflect.DeepEqual(got, []string{"partner", "old", "new"}) {
+		t.Errorf("published %v before the rotation, want the upcoming key too", got)
+	}
+
+	newToken, kid := sign(start)
+	if kid != "new" {
+		t.Fatalf("signed with %q after the rotation, want new", kid)
+	}
+	if !verifies(oldToken, start.Add(ttl-time.Second)) {
+		t.Error("the replaced key stopped verifying before the token lifetime")
+	}
+	if verifies(oldToken, start.Add(ttl)) {
+		t.Error("the replaced key still verifies after the token lifetime")
+	}
+	if !verifies(newToken, start.Add(ttl)) {
+		t.Error("the current key does not verify")
+	}
+	if got := kids(set.JWKS()); !reflect.DeepEqual(got, []string{"partner", "new"}) {
+		t.Errorf("published %v after the token lifetime, want the replaced key removed", got)
+	}
+}
+
+func TestKeySetParseRefusesAlgorithmMismatch(t *testing.T) {
+	keys := newTestKeys(t)
+	set := rotation(t, keys, time.Now().Add(-time.Minute), time.Hour)
+
+	tests := []struct {
+		name   string
+		method jwt.SigningMethod
+		kid    string
+		key    interface{}
+	}{
+		// Signed with the right private key, but a header naming another algorithm
+		{"kid of another algorithm", SigningMethodEdDSA, "old", keys.signers["EdDSA"]},
+		// The classic confusion: an HMAC keyed with the public key
+		{"hmac with a public key", jwt.SigningMethodHS256, "partner", x509.MarshalPKCS1PublicKey(keys.signers["RS256"].Public().(*rsa.PublicKey))},
+		{"unknown kid", SigningMethodEdDSA, "missing", keys.signers["EdDSA"]},
+		{"no kid", SigningMethodEdDSA, "", keys.signers["EdDSA"]},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token := jwt.NewWithClaims(test.method, jwt.StandardClaims{Subject: "1"})
+			if test.kid != "" {
+				token.Header["kid"] = test.kid
+			}
+			signed, err := token.SignedString(test.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := set.Parse(signed, &jwt.StandardClaims{}); err == nil {
+				t.Error("token accepted")
+			}
+		})
+	}
+
+	token := jwt.NewWithClaims(SigningMethodEdDSA, jwt.StandardClaims{Subject: "1"})
+	token.Header["kid"] = "new"
+	signed, err := token.SignedString(keys.signers["EdDSA"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := set.Parse(signed, &jwt.StandardClaims{}); err != nil {
+		t.Errorf("token of the right key refused: %v", err)
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	keys := newTestKeys(t)
+	set, err := LoadKeySet([]config.SigningKey{
+		{ID: "rsa", PrivateKeyFile: keys.rsa},
+		{ID: "ec", PrivateKeyFile: keys.ec},
+		{ID: "ed", PrivateKeyFile: keys.ed},
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]JWK{
+		"rsa": {Kty: "RSA", Kid: "rsa", Use: "sig", Alg: "RS256"},
+		"ec":  {Kty: "EC", Kid: "ec", Use: "sig", Alg: "ES256", Crv: "P-256"},
+		"ed":  {Kty: "OKP", Kid: "ed", Use: "sig", Alg: "EdDSA", Crv: "Ed25519"},
+	}
+	jwks := set.JWKS()
+	if len(jwks.Keys) != len(want) {
+		t.Fatalf("got %d keys, want %d", len(jwks.Keys), len(want))
+	}
+	for _, jwk := range jwks.Keys {
+		public, err := jwk.PublicKey()
+		if err != nil {
+			t.Errorf("%s: %v", jwk.Kid, err)
+			continue
+		}
+		if !keys.signers[jwk.Alg].Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(public) {
+			t.Errorf("%s: the published key does not decode to the public key", jwk.Kid)
+		}
+		jwk.N, jwk.E, jwk.X, jwk.Y = "", "", "", ""
+		if jwk != want[jwk.Kid] {
+			t.Errorf("got %+v, want %+v", jwk, want[jwk.Kid])
+		}
+	}
+
+	if jwks := NewSecretKeySet("secret").JWKS(); len(jwks.Keys) != 0 {
+		t.Errorf("published %d secret keys", len(jwks.Keys))
+	}
+}
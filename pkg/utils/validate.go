@@ -23,11 +23,11 @@ func ValidatePageNumber(page int) (bool, error) {
 }
 
 // Validate data limit for pagination
-func ValidateDataLimit(limit int) int {
+func ValidateDataLimit(limit int, pagination config.Pagination) int {
 	if limit <= 0 {
-		return config.DefaultLimit
-	} else if limit > config.MaximumLimit {
-		return config.MaximumLimit
+		return pagination.DefaultLimit
+	} else if limit > pagination.MaximumLimit {
+		return pagination.MaximumLimit
 	}
 	return limit
 }